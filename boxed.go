@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// EducateBoxed educates s, wraps it to width columns, and draws a box around it, for eyeballing the result in a terminal.
+//
+// If s can’t be educated, it’s boxed up as-is. Widths are counted in runes, so wide characters like CJK ideographs will make the right side of the box ragged, and widths under 1 are taken to be 1.
+func EducateBoxed(s string, width int) string {
+	boxed, err := EducateBoxedWithOptions(s, width, DefaultOptions())
+	if err != nil {
+		return drawBox(s, width)
+	}
+	return boxed
+}
+
+// EducateBoxedWithOptions is like EducateBoxed, but educates s the way opts says to, and returns the error instead of boxing up s as-is if it can’t. It’s what -preview prints.
+func EducateBoxedWithOptions(s string, width int, opts Options) (string, error) {
+	educated, err := educateString(s, opts)
+	if err != nil {
+		return "", err
+	}
+	return drawBox(educated, width), nil
+}
+
+// drawBox wraps s to width columns and draws a box around it.
+func drawBox(s string, width int) string {
+	if width < 1 {
+		width = 1
+	}
+
+	var b strings.Builder
+	b.WriteString("┌" + strings.Repeat("─", width+2) + "┐\n")
+	for _, line := range wrap(strings.TrimRight(s, "\n"), width) {
+		b.WriteString("│ " + line + strings.Repeat(" ", width-utf8.RuneCountInString(line)) + " │\n")
+	}
+	b.WriteString("└" + strings.Repeat("─", width+2) + "┘\n")
+
+	return b.String()
+}
+
+// wrap breaks each line of s into lines no more than width runes long, breaking at spaces where it can and in the middle of words that are too long by themselves.
+func wrap(s string, width int) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(s, "\n") {
+		var line []rune
+		for _, word := range strings.Fields(paragraph) {
+			w := []rune(word)
+			if len(line) > 0 && len(line)+1+len(w) <= width {
+				line = append(append(line, ' '), w...)
+				continue
+			}
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+			}
+			for len(w) > width {
+				lines = append(lines, string(w[:width]))
+				w = w[width:]
+			}
+			line = w
+		}
+		lines = append(lines, string(line))
+	}
+
+	return lines
+}
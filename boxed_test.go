@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateBoxed(t *testing.T) {
+	rows := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{`She said, "It's fine."`, 12, "┌──────────────┐\n│ She said,    │\n│ “It’s fine.” │\n└──────────────┘\n"},
+		{"'Hi'\n\nthere", 6, "┌────────┐\n│ ‘Hi’   │\n│        │\n│ there  │\n└────────┘\n"},
+		{"abcdefgh", 3, "┌─────┐\n│ abc │\n│ def │\n│ gh  │\n└─────┘\n"},
+	}
+
+	for _, row := range rows {
+		if got := quotes.EducateBoxed(row.in, row.width); got != row.want {
+			t.Errorf("\nsource:   «%s»\nexpected:\n%s\ngot:\n%s", row.in, row.want, got)
+		}
+	}
+}
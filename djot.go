@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// registerDjot swaps the Markdown-and-HTML-specific callbacks for Djot ones. Djot doesn’t have raw HTML (just autolinks) or front matter, its verbatim spans go on to the end of the paragraph if they’re never closed, and anything in braces that looks like attributes, like «{#id title="It's"}», is left alone. Code blocks and backslash escapes work the same as in Markdown, so those stay.
+func registerDjot(s *state) {
+	s.whatDo['<'] = atDjotLessThan
+	s.whatDo['`'] = atDjotBacktick
+	s.whatDo['{'] = atDjotBrace
+
+	// With nothing to skip, a --- at the start is just a thematic break.
+	skipContexts := s.opts.SkipContexts
+	s.opts.SkipContexts = nil
+	for _, c := range skipContexts {
+		if c != ContextYAML {
+			s.opts.SkipContexts = append(s.opts.SkipContexts, c)
+		}
+	}
+}
+
+// atDjotLessThan reads an assumed-to-exist < and copies the autolink it starts, if it starts one. Otherwise it’s just a <.
+func atDjotLessThan(s *state) error {
+	r := s.mustReadRune()
+	if r != '<' {
+		return fmt.Errorf("expecting a less-than symbol (<). got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	if m := autolink.Find(s.src[s.currentOffset():]); m != nil {
+		return s.AdvanceBy(utf8.RuneCount(m))
+	}
+
+	return nil
+}
+
+// atDjotBacktick reads an assumed-to-exist ` and copies the verbatim span it starts through a closing run of as many backticks as opened it. Backslashes don’t escape anything in there.
+//
+// Code blocks and everything Options can change about backticks are handled like they are in Markdown, by atBacktick.
+func atDjotBacktick(s *state) error {
+	if (s.PeekEquals("```") && s.atStartOfLine()) || s.opts.LegacyGraveQuotes || !s.skips(ContextInlineCode) {
+		return atBacktick(s)
+	}
+
+	r := s.mustReadRune()
+	if r != '`' {
+		return fmt.Errorf("expecting a backtick. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	paragraph := s.src[s.currentOffset():]
+	if end := bytes.Index(paragraph, []byte("\n\n")); end >= 0 {
+		paragraph = paragraph[:end]
+	}
+
+	extra := len(paragraph) - len(bytes.TrimLeft(paragraph, "`"))
+	if end := closingBacktickRun(paragraph[extra:], extra+1); end >= 0 {
+		return s.AdvanceBy(utf8.RuneCount(paragraph[:extra+end]))
+	}
+
+	// Unlike in Markdown, a verbatim span that’s never closed isn’t just backticks. It goes on to the end of the paragraph.
+	return s.AdvanceBy(utf8.RuneCount(paragraph))
+}
+
+// atDjotBrace reads an assumed-to-exist { and copies the attributes it starts, like «{#id .class title="It's"}», or the format of a raw inline, like the {=html} in «`<br>`{=html}».
+//
+// Braces are in plenty of other Djot syntax, like «{_emphasis_}» and «{=highlighting=}», and those are still prose.
+func atDjotBrace(s *state) error {
+	r := s.mustReadRune()
+	if r != '{' {
+		return fmt.Errorf("expecting an opening brace. got: «%s» (%U)", string(r), r)
+	}
+	afterVerbatim := s.previousRuneMatchesAny('`')
+	s.writeRune(r)
+
+	ahead := s.src[s.currentOffset():]
+	n := djotAttributesLength(ahead)
+	if n < 0 && afterVerbatim && len(ahead) > 0 && ahead[0] == '=' {
+		if m := djotNameLength(ahead[1:]); m > 0 && 1+m < len(ahead) && ahead[1+m] == '}' {
+			n = 1 + m + 1
+		}
+	}
+	if n < 0 {
+		return nil
+	}
+
+	return s.AdvanceBy(utf8.RuneCount(ahead[:n]))
+}
+
+// djotAttributesLength returns how long the attributes at the start of b are, through the closing brace, or -1 if b doesn’t start with attributes. The opening brace has already been read.
+//
+// Attributes are any number of #ids, .classes, key=value and key="quoted value" pairs, and %comments%, separated by whitespace.
+func djotAttributesLength(b []byte) int {
+	for i := 0; i < len(b); {
+		switch c := b[i]; {
+		case c == '}':
+			return i + 1
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || c == '.':
+			n := djotNameLength(b[i+1:])
+			if n == 0 {
+				return -1
+			}
+			i += 1 + n
+		case c == '%':
+			end := bytes.IndexByte(b[i+1:], '%')
+			if end < 0 {
+				return -1
+			}
+			i += 1 + end + 1
+		case isDjotNameByte(c):
+			i += djotNameLength(b[i:])
+			if i >= len(b) || b[i] != '=' {
+				return -1
+			}
+			i++
+
+			if i < len(b) && b[i] == '"' {
+				n := djotQuotedValueLength(b[i:])
+				if n < 0 {
+					return -1
+				}
+				i += n
+			} else {
+				n := djotNameLength(b[i:])
+				if n == 0 {
+					return -1
+				}
+				i += n
+			}
+		default:
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// djotQuotedValueLength returns how long the double-quoted attribute value at the start of b is, quote marks and all, or -1 if it’s never closed. Backslashes escape quote marks.
+func djotQuotedValueLength(b []byte) int {
+	for i := 1; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// djotNameLength returns how many bytes at the start of b can be in an id, a class, a key, or an unquoted value.
+func djotNameLength(b []byte) int {
+	n := 0
+	for n < len(b) && isDjotNameByte(b[n]) {
+		n++
+	}
+	return n
+}
+
+func isDjotNameByte(c byte) bool {
+	return isASCIILetter(rune(c)) || isASCIIDigit(rune(c)) || c == '_' || c == '-' || c == ':'
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestDjot(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Djot = true
+
+	rows := []Row{
+		{"It's \"Djot\".", "It’s “Djot”."},
+
+		// verbatim
+		{"Use `print(\"hi\")` and it's done.", "Use `print(\"hi\")` and it’s done."},
+		{"``a`'b'`` 'c'", "``a`'b'`` ‘c’"},
+		{"`C:\\` isn't escaped", "`C:\\` isn’t escaped"},
+		{"`it's never closed\nstill 'verbatim'\n\nIt's prose.", "`it's never closed\nstill 'verbatim'\n\nIt’s prose."},
+		{"```python\nprint('hi')\n```\nThat's it.", "```python\nprint('hi')\n```\nThat’s it."},
+		{"`<b title=\"x\">`{=html} \"y\"", "`<b title=\"x\">`{=html} “y”"},
+		{"$`f'(x)` is \"math\"", "$`f'(x)` is “math”"},
+
+		// attributes
+		{`[It's here]{#id .note title="It's \"q\"" data-x=y} and "more"`, `[It’s here]{#id .note title="It's \"q\"" data-x=y} and “more”`},
+		{"{.warning title=\"Don't\"}\nIt's a warning.", "{.warning title=\"Don't\"}\nIt’s a warning."},
+		{"{title=\"spans\nlines\"} \"x\"", "{title=\"spans\nlines\"} “x”"},
+		{"{% it's a comment %} 'x'", "{% it's a comment %} ‘x’"},
+
+		// braces that aren’t attributes
+		{"{_it's_} and {=it's=} and {+'ins'+}", "{_it’s_} and {=it’s=} and {+‘ins’+}"},
+		{"{title=unclosed \"x\"", "{title=unclosed “x”"},
+
+		// no HTML or front matter
+		{`<b title="it's">`, `<b title=“it’s”>`},
+		{"<https://example.com/it's> 'x'", "<https://example.com/it's> ‘x’"},
+		{"---\n\"Break\"\n---", "---\n“Break”\n---"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
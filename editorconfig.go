@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// editorConfig holds the .editorconfig properties that matter when rewriting a file. Empty strings mean nothing said anything about that property.
+type editorConfig struct {
+	endOfLine          string // lf, crlf, or cr
+	charset            string // utf-8 or utf-8-bom are the ones I care about
+	insertFinalNewline string // true or false
+}
+
+// findEditorConfig looks for .editorconfig files in path’s directory and every directory above it, stopping at one that says root = true, and works out what they say about path. Closer files win.
+func findEditorConfig(path string) (editorConfig, error) {
+	var ec editorConfig
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ec, err
+	}
+
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		contents, err := os.ReadFile(filepath.Join(dir, ".editorconfig"))
+		if err == nil {
+			rel, _ := filepath.Rel(dir, abs)
+			if parseEditorConfig(contents, filepath.ToSlash(rel), &ec) {
+				break
+			}
+		} else if !os.IsNotExist(err) {
+			return ec, err
+		}
+
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	return ec, nil
+}
+
+// parseEditorConfig fills in whatever ec doesn’t already have from the sections of contents that match rel, the path of the file relative to the .editorconfig. Later sections in a file beat earlier ones. It returns true if the file says root = true before its first section, which is the only place root counts.
+func parseEditorConfig(contents []byte, rel string, ec *editorConfig) (root bool) {
+	var found editorConfig
+	preamble, matching := true, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			preamble = false
+			matching = editorConfigGlobMatches(line[1:len(line)-1], rel)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		switch {
+		case key == "root" && preamble:
+			root = value == "true"
+		case !matching:
+		case key == "end_of_line":
+			found.endOfLine = value
+		case key == "charset":
+			found.charset = value
+		case key == "insert_final_newline":
+			found.insertFinalNewline = value
+		}
+	}
+
+	if ec.endOfLine == "" {
+		ec.endOfLine = found.endOfLine
+	}
+	if ec.charset == "" {
+		ec.charset = found.charset
+	}
+	if ec.insertFinalNewline == "" {
+		ec.insertFinalNewline = found.insertFinalNewline
+	}
+
+	return root
+}
+
+// editorConfigGlobMatches reports whether an .editorconfig section name like *.md or docs/**.{md,txt} matches rel. A glob without a slash in it matches files with that name in any directory.
+func editorConfigGlobMatches(glob, rel string) bool {
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+	glob = strings.TrimPrefix(glob, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '{':
+			b.WriteString("(?:")
+		case '}':
+			b.WriteString(")")
+		case ',':
+			b.WriteString("|")
+		case '[':
+			b.WriteByte(c)
+			if i+1 < len(glob) && glob[i+1] == '!' {
+				i++
+				b.WriteByte('^')
+			}
+		case ']':
+			b.WriteByte(c)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(rel)
+}
+
+// newline returns the line ending ec’s end_of_line calls for, or "" if it doesn’t say.
+func (ec editorConfig) newline() string {
+	return map[string]string{"lf": "\n", "crlf": "\r\n", "cr": "\r"}[ec.endOfLine]
+}
+
+// apply rewrites out the way ec says it should look: with the right line endings, with or without a byte-order mark, and with a final newline if one’s called for.
+func (ec editorConfig) apply(out []byte) []byte {
+	newline := ec.newline()
+	if newline != "" {
+		normalized := bytes.ReplaceAll(out, []byte("\r\n"), []byte("\n"))
+		normalized = bytes.ReplaceAll(normalized, []byte("\r"), []byte("\n"))
+		out = bytes.ReplaceAll(normalized, []byte("\n"), []byte(newline))
+	}
+
+	if ec.insertFinalNewline == "true" && len(out) > 0 && out[len(out)-1] != '\n' && out[len(out)-1] != '\r' {
+		if newline == "" {
+			newline = "\n"
+		}
+		out = append(out, newline...)
+	}
+
+	const bom = "\uFEFF"
+	switch ec.charset {
+	case "utf-8-bom":
+		if !bytes.HasPrefix(out, []byte(bom)) {
+			out = append([]byte(bom), out...)
+		}
+	case "utf-8":
+		out = bytes.TrimPrefix(out, []byte(bom))
+	}
+
+	return out
+}
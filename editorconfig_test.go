@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditorConfigGlobMatches(t *testing.T) {
+	rows := []struct {
+		Glob, Path string
+		Want       bool
+	}{
+		{"*", "a.md", true},
+		{"*.md", "docs/a.md", true},
+		{"*.md", "a.txt", false},
+		{"*.{md,txt}", "a.txt", true},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/deep/a.md", false},
+		{"docs/**.md", "docs/deep/a.md", true},
+		{"/a.md", "a.md", true},
+		{"a?.md", "ab.md", true},
+		{"[ab].md", "c.md", false},
+		{"[!ab].md", "c.md", true},
+	}
+
+	for _, row := range rows {
+		if got := editorConfigGlobMatches(row.Glob, row.Path); got != row.Want {
+			t.Errorf("editorConfigGlobMatches(%q, %q) = %v, want %v", row.Glob, row.Path, got, row.Want)
+		}
+	}
+}
+
+func TestEditorConfigFlag(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "posts")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := "root = true\n\n[*]\nend_of_line = lf\n\n[*.md]\nend_of_line = crlf\ninsert_final_newline = true\n"
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Closer files win, and this one doesn’t say root = true, so the one above still counts
+	if err := os.WriteFile(filepath.Join(sub, ".editorconfig"), []byte("[*.md]\ncharset = utf-8-bom\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(sub, "post.md")
+	if err := os.WriteFile(path, []byte("It's \"here\".\nAnd 'there'."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run([]string{"-w", "-editorconfig", path}, strings.NewReader(""), io.Discard, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\uFEFFIt’s “here”.\r\nAnd ‘there’.\r\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEditorConfigExtraNewline(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n\n[*]\nend_of_line = crlf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "post.md")
+	if err := os.WriteFile(path, []byte("It's \"here\".\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run([]string{"-w", "-editorconfig", "-n", path}, strings.NewReader(""), io.Discard, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "It’s “here”.\r\n\r\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEditorConfigRootOnlyInPreamble(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "posts")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n\n[*]\nend_of_line = crlf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A root = true in a section doesn’t count, so the one above still does
+	if err := os.WriteFile(filepath.Join(sub, ".editorconfig"), []byte("[*.txt]\nroot = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ec, err := findEditorConfig(filepath.Join(sub, "post.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.endOfLine != "crlf" {
+		t.Errorf("expected end_of_line = crlf from the parent .editorconfig, got %q", ec.endOfLine)
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// An Edit says that the bytes from OldStart up to (but not including) OldEnd in Educate’s input were replaced with NewText.
+type Edit struct {
+	OldStart, OldEnd int
+	NewText          string
+}
+
+// EducateWithEdits educates s like Educate does and also returns every change it made, in order, as byte offsets into s. Applying the edits to s gets you out. It fails whenever Educate would, like when a <code> element is never closed.
+//
+// It’s for editors that want to underline or highlight what changed without diffing the before and after themselves.
+func EducateWithEdits(s string) (out string, edits []Edit, err error) {
+	st, err := newState(bytes.NewReader([]byte(s)), DefaultOptions())
+	if err != nil {
+		return "", nil, err
+	}
+
+	st.recordEdits = true
+	if st.start > 0 {
+		// newState skipped the byte-order mark, and it won’t be written out
+		st.edits = append(st.edits, Edit{OldStart: 0, OldEnd: int(st.start)})
+	}
+
+	if err := initial(&st); err != nil && err != io.EOF {
+		return "", nil, err
+	}
+
+	return st.w.String(), st.edits, nil
+}
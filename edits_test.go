@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"reflect"
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateWithEdits(t *testing.T) {
+	rows := []struct {
+		In        string
+		WantOut   string
+		WantEdits []quotes.Edit
+	}{
+		{
+			`"hi" and 'bye'`,
+			`“hi” and ‘bye’`,
+			[]quotes.Edit{
+				{OldStart: 0, OldEnd: 1, NewText: "“"},
+				{OldStart: 3, OldEnd: 4, NewText: "”"},
+				{OldStart: 9, OldEnd: 10, NewText: "‘"},
+				{OldStart: 13, OldEnd: 14, NewText: "’"},
+			},
+		},
+		{
+			"“Done” `'code'` isn't",
+			"“Done” `'code'` isn’t",
+			[]quotes.Edit{{OldStart: 23, OldEnd: 24, NewText: "’"}},
+		},
+		{
+			"\uFEFFit's",
+			"it’s",
+			[]quotes.Edit{
+				{OldStart: 0, OldEnd: 3, NewText: ""},
+				{OldStart: 5, OldEnd: 6, NewText: "’"},
+			},
+		},
+		{"No quotes.", "No quotes.", nil},
+	}
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			out, edits, err := quotes.EducateWithEdits(row.In)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != row.WantOut {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.WantOut, out)
+			}
+			if !reflect.DeepEqual(edits, row.WantEdits) {
+				t.Errorf("\nexpected edits: %+v\ngot:            %+v", row.WantEdits, edits)
+			}
+
+			// Applying the edits back to front gets the same output
+			applied := row.In
+			for i := len(edits) - 1; i >= 0; i-- {
+				applied = applied[:edits[i].OldStart] + edits[i].NewText + applied[edits[i].OldEnd:]
+			}
+			if applied != out {
+				t.Errorf("applying the edits got «%s», not «%s»", applied, out)
+			}
+		})
+	}
+}
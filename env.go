@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// environmentFlags maps the environment variables runEducate pays attention to onto the flags they stand in for. Flags are awkward to pass in some places (Docker images with a fixed entrypoint, CI steps somebody else wrote), and environment variables aren’t.
+var environmentFlags = []struct {
+	variable, flag string
+}{
+	{"QUOTE_EDUCATOR_LANG", "lang"},
+	{"QUOTE_EDUCATOR_DASHES", "dashes"},
+	{"QUOTE_EDUCATOR_QUIET", "q"},
+}
+
+// applyEnvironment sets every flag in environmentFlags that wasn’t given on the command line to its environment variable’s value, as found by lookup (os.LookupEnv, outside of tests). Flags given explicitly always win, and flags with no variable set keep their defaults.
+//
+// Values go through flags.Set, so a QUOTE_EDUCATOR_DASHES of «maybe» is an error the same way «-dashes=maybe» would be.
+func applyEnvironment(flags *flag.FlagSet, lookup func(string) (string, bool)) error {
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, ef := range environmentFlags {
+		if explicit[ef.flag] {
+			continue
+		}
+		value, ok := lookup(ef.variable)
+		if !ok {
+			continue
+		}
+		if err := flags.Set(ef.flag, value); err != nil {
+			return fmt.Errorf("bad value «%s» for %s: %w", value, ef.variable, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// fountainSceneHeading matches the start of a Fountain scene heading, like «INT. HOUSE - DAY» or a forced one like «.FLASHBACK».
+var fountainSceneHeading = regexp.MustCompile(`^(?i:(?:int\.?/ext|int/ext|i/e|int|ext|est)[. ])|^\.[^.]`)
+
+// fountainTitleKey matches a title page key, like the «Title:» in «Title: Big Fish».
+var fountainTitleKey = regexp.MustCompile(`^[A-Za-z][A-Za-z ]*:`)
+
+// EducateFountain reads a Fountain screenplay from in, educates its action, dialogue, lyrics, and title page values, and writes the result to out.
+//
+// Scene headings, transitions (like «CUT TO:»), character names (whose «(CONT'D)» stays as it is), page breaks, sections, synopses, and notes that take up a whole paragraph are copied as-is. Each paragraph is educated on its own, like a cue in EducateSubtitles, so a quote left open in one doesn’t spill into the next, but a character’s dialogue is educated all together, parentheticals and all. Fountain doesn’t have HTML, so a < is always just a <.
+func EducateFountain(in io.Reader, out io.Writer) error {
+	contents, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	opts := DefaultOptions()
+	opts.NoHTML = true
+
+	var b strings.Builder
+	var block []string
+	first := true
+
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		educated, err := educateFountainBlock(block, first, opts)
+		if err != nil {
+			return err
+		}
+		b.WriteString(educated)
+		block = block[:0]
+		first = false
+		return nil
+	}
+
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return err
+			}
+			b.WriteString(line)
+			continue
+		}
+		block = append(block, line)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, b.String())
+	return err
+}
+
+// educateFountainBlock educates one paragraph of a Fountain screenplay, figuring out what kind of element it is from its first line. first says whether it’s the first paragraph in the file, which is the only place a title page can be.
+func educateFountainBlock(lines []string, first bool, opts Options) (string, error) {
+	head := strings.TrimSpace(lines[0])
+
+	switch {
+	case first && fountainTitleKey.MatchString(lines[0]):
+		return educateFountainTitlePage(lines, opts)
+	case strings.HasPrefix(head, "==="),
+		strings.HasPrefix(head, "#"),
+		strings.HasPrefix(head, "=") && !strings.HasPrefix(head, "=="),
+		strings.HasPrefix(head, "[[") && strings.HasSuffix(strings.TrimSpace(lines[len(lines)-1]), "]]"):
+		return strings.Join(lines, ""), nil
+	case len(lines) == 1 && fountainSceneHeading.MatchString(head):
+		return lines[0], nil
+	case len(lines) == 1 && isFountainTransition(head):
+		return lines[0], nil
+	case len(lines) > 1 && isFountainCharacter(head):
+		dialogue, err := educateString(strings.Join(lines[1:], ""), opts)
+		return lines[0] + dialogue, err
+	case strings.HasPrefix(head, "~"):
+		return educateFountainLyrics(lines, opts)
+	}
+
+	return educateString(strings.Join(lines, ""), opts)
+}
+
+// educateFountainTitlePage educates the values on a title page, leaving the keys alone. Values that go on for more than one line are educated a line at a time.
+func educateFountainTitlePage(lines []string, opts Options) (string, error) {
+	var b strings.Builder
+	for _, line := range lines {
+		key := fountainTitleKey.FindString(line)
+		value, err := educateString(line[len(key):], opts)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(key + value)
+	}
+	return b.String(), nil
+}
+
+// educateFountainLyrics educates each line of lyrics after its ~.
+func educateFountainLyrics(lines []string, opts Options) (string, error) {
+	var b strings.Builder
+	for _, line := range lines {
+		marker := line[:len(line)-len(strings.TrimLeft(line, " \t~"))]
+		lyric, err := educateString(line[len(marker):], opts)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(marker + lyric)
+	}
+	return b.String(), nil
+}
+
+// isFountainTransition returns true if line is a transition, like «CUT TO:», or a forced one, like «> BURN TO WHITE.». A line that starts with > and ends with < is centered text, not a transition.
+func isFountainTransition(line string) bool {
+	if strings.HasPrefix(line, ">") {
+		return !strings.HasSuffix(line, "<")
+	}
+	return strings.HasSuffix(line, "TO:") && isAllCaps(line)
+}
+
+// isFountainCharacter returns true if line is a character name that starts some dialogue, like «MCCLANE», «@McClane», or «HANS (V.O.)». Only the name has to be in capitals; extensions like «(cont'd)» don’t.
+func isFountainCharacter(line string) bool {
+	if strings.HasPrefix(line, "@") {
+		return true
+	}
+	if strings.HasPrefix(line, "!") {
+		return false // forced action
+	}
+
+	name, _, _ := strings.Cut(line, "(")
+	return isAllCaps(strings.TrimSuffix(strings.TrimSpace(name), "^"))
+}
+
+// isAllCaps returns true if s has at least one letter and none of its letters are lowercase.
+func isAllCaps(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0 && strings.IndexFunc(s, unicode.IsLower) < 0
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"strings"
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateFountain(t *testing.T) {
+	rows := []struct {
+		Name string
+		In   string
+		Want string
+	}{
+		{
+			"title page",
+			"Title: \"Brick's\" Steel\nCredit: Written by\nAuthor: Stu O'Neil\nNotes:\n\tIt's a \"draft\"\n\nINT. JOE'S DINER - NIGHT\n",
+			"Title: “Brick’s” Steel\nCredit: Written by\nAuthor: Stu O’Neil\nNotes:\n\tIt’s a “draft”\n\nINT. JOE'S DINER - NIGHT\n",
+		},
+		{
+			"dialogue",
+			"EXT. BRICK'S PATIO - DAY\n\nSteel's \"fine\" <really>.\n\nSTEEL (CONT'D)\n(beat)\nI don't know what \"it\" is.\nIt's 'right there.'\n\n@McCLANE\nYippee-ki-yay, it's \"over.\"\n",
+			"EXT. BRICK'S PATIO - DAY\n\nSteel’s “fine” <really>.\n\nSTEEL (CONT'D)\n(beat)\nI don’t know what “it” is.\nIt’s ‘right there.’\n\n@McCLANE\nYippee-ki-yay, it’s “over.”\n",
+		},
+		{
+			"transitions and page breaks",
+			"They're gone.\n\nCUT TO:\n\n> BURN TO 'WHITE'.\n\n===\n\n>\"THE END\"<\n",
+			"They’re gone.\n\nCUT TO:\n\n> BURN TO 'WHITE'.\n\n===\n\n>“THE END”<\n",
+		},
+		{
+			"lyrics",
+			"~Willy's \"gonna\" sing\n~ 'cause it's time\n",
+			"~Willy’s “gonna” sing\n~ ’cause it’s time\n",
+		},
+		{
+			"sections, synopses, and notes",
+			"# Act 'One'\n\n= Brick's \"plan\" fails.\n\n[[Don't forget the \"props\"]]\n\n.FLASHBACK TO '99\n\nIt's 1999.\n",
+			"# Act 'One'\n\n= Brick's \"plan\" fails.\n\n[[Don't forget the \"props\"]]\n\n.FLASHBACK TO '99\n\nIt’s 1999.\n",
+		},
+		{
+			"quotes don't spill across paragraphs",
+			"\"Unclosed\n\n\"Opened\" again\r\n",
+			"“Unclosed\n\n“Opened” again\r\n",
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.Name, func(t *testing.T) {
+			var out strings.Builder
+			if err := quotes.EducateFountain(strings.NewReader(row.In), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != row.Want {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.Want, out.String())
+			}
+		})
+	}
+}
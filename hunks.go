@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EducateHunks educates only the given lines of original and leaves every other line byte-for-byte identical.
+//
+// Each range is a pair of 1-based, inclusive line numbers, like the ones in a diff hunk header. The whole document is educated so that quote state carries over from the lines before each range, but only the lines inside the ranges make it into the result.
+func EducateHunks(original string, ranges [][2]int) (string, error) {
+	originalLines := strings.Split(original, "\n")
+
+	for _, rng := range ranges {
+		if rng[0] < 1 || rng[1] < rng[0] || rng[1] > len(originalLines) {
+			return "", fmt.Errorf("EducateHunks: line range %d–%d is out of bounds for a %d-line document", rng[0], rng[1], len(originalLines))
+		}
+	}
+
+	educated, err := educateString(original, DefaultOptions())
+	if err != nil {
+		return "", err
+	}
+
+	educatedLines := strings.Split(educated, "\n")
+	if len(educatedLines) != len(originalLines) {
+		// Educate never adds or removes newlines, so this should never happen
+		return "", fmt.Errorf("EducateHunks: educating changed the line count from %d to %d", len(originalLines), len(educatedLines))
+	}
+
+	for _, rng := range ranges {
+		for i := rng[0] - 1; i < rng[1]; i++ {
+			originalLines[i] = educatedLines[i]
+		}
+	}
+
+	return strings.Join(originalLines, "\n"), nil
+}
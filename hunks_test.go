@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateHunks(t *testing.T) {
+	original := "Don't touch this.\n\"Start of a quote\nthat ends here.\" It's edited.\nOr this 'one'.\n"
+
+	rows := []struct {
+		Name   string
+		Ranges [][2]int
+		Want   string
+	}{
+		{
+			"no ranges",
+			nil,
+			original,
+		},
+		{
+			"middle hunk",
+			[][2]int{{3, 3}},
+			"Don't touch this.\n\"Start of a quote\nthat ends here.” It’s edited.\nOr this 'one'.\n",
+		},
+		{
+			"two hunks",
+			[][2]int{{1, 1}, {4, 4}},
+			"Don’t touch this.\n\"Start of a quote\nthat ends here.\" It's edited.\nOr this ‘one’.\n",
+		},
+		{
+			"everything",
+			[][2]int{{1, 5}},
+			"Don’t touch this.\n“Start of a quote\nthat ends here.” It’s edited.\nOr this ‘one’.\n",
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.Name, func(t *testing.T) {
+			got, err := quotes.EducateHunks(original, row.Ranges)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != row.Want {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.Want, got)
+			}
+		})
+	}
+}
+
+func TestEducateHunksOutOfBounds(t *testing.T) {
+	for _, rng := range [][2]int{{0, 1}, {2, 1}, {1, 3}} {
+		if _, err := quotes.EducateHunks("one\ntwo", [][2]int{rng}); err == nil {
+			t.Errorf("expected an error for range %v", rng)
+		}
+	}
+}
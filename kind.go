@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// A Kind is the broad sort of document that DetectKind thinks it’s looking at.
+type Kind int
+
+const (
+	KindPlainText Kind = iota
+	KindMarkdown
+	KindHTML
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindPlainText:
+		return "text"
+	case KindMarkdown:
+		return "markdown"
+	case KindHTML:
+		return "html"
+	}
+	return "unknown"
+}
+
+// DetectKind guesses whether s is HTML (it starts with a tag or a doctype), Markdown (it has front matter, a code fence, or a heading), or plain text.
+//
+// It’s a cheap heuristic meant for picking Options, not a validator.
+func DetectKind(s string) Kind {
+	trimmed := strings.TrimLeft(s, "\uFEFF \t\r\n")
+
+	if len(trimmed) > 1 && trimmed[0] == '<' {
+		if strings.HasPrefix(strings.ToLower(trimmed), "<!doctype") || isASCIILetter(rune(trimmed[1])) {
+			return KindHTML
+		}
+	}
+
+	if strings.HasPrefix(s, "---\n") || strings.HasPrefix(s, "---\r\n") {
+		return KindMarkdown
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "```") || isATXHeading(line) {
+			return KindMarkdown
+		}
+	}
+
+	return KindPlainText
+}
+
+// isATXHeading returns true if line starts with one to six #s and then a space, like «## Heading».
+func isATXHeading(line string) bool {
+	hashes := len(line) - len(strings.TrimLeft(line, "#"))
+	return hashes >= 1 && hashes <= 6 && strings.HasPrefix(line[hashes:], " ")
+}
+
+func isASCIILetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
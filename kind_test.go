@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestDetectKind(t *testing.T) {
+	rows := []struct {
+		In   string
+		Want quotes.Kind
+	}{
+		{"", quotes.KindPlainText},
+		{"Just some text. It's fine.", quotes.KindPlainText},
+		{"a < b and c > d", quotes.KindPlainText},
+		{"#hashtag isn't a heading", quotes.KindPlainText},
+		{"---\ntitle: x\n---\n\nBody", quotes.KindMarkdown},
+		{"---\r\ntitle: x\r\n---\r\n\r\nBody", quotes.KindMarkdown},
+		{"Intro\n\n```\ncode\n```\n", quotes.KindMarkdown},
+		{"# Heading\n\nText", quotes.KindMarkdown},
+		{"Text\n\n### Subheading\n", quotes.KindMarkdown},
+		{"<!DOCTYPE html>\n<html>", quotes.KindHTML},
+		{"  \n<div class=x>Hi</div>", quotes.KindHTML},
+		{"\uFEFF<p>Hi</p>", quotes.KindHTML},
+	}
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			if got := quotes.DetectKind(row.In); got != row.Want {
+				t.Errorf("expected %v, got %v", row.Want, got)
+			}
+		})
+	}
+}
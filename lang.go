@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// languageQuotes holds the outer and inner quote marks for each language (and sometimes region) OptionsForLanguage knows about, in the order OpenDouble, CloseDouble, OpenSingle, CloseSingle.
+var languageQuotes = map[string][4]rune{
+	"en":      {'“', '”', '‘', '’'},
+	"en-gb":   {'‘', '’', '“', '”'},
+	"de":      {'„', '“', '‚', '‘'},
+	"de-ch":   {'«', '»', '‹', '›'},
+	"fr":      {'«', '»', '“', '”'},
+	"fr-ch":   {'«', '»', '‹', '›'},
+	"es":      {'«', '»', '“', '”'},
+	"ja":      {'「', '」', '『', '』'},
+	"zh":      {'“', '”', '‘', '’'},
+	"zh-hant": {'「', '」', '『', '』'},
+	"zh-tw":   {'「', '」', '『', '』'},
+	"zh-hk":   {'「', '」', '『', '』'},
+}
+
+// OptionsForLanguage returns DefaultOptions with the quote marks that tag’s language uses, where tag is a BCP-47 language tag like "de" or "fr-CH".
+//
+// A tag OptionsForLanguage doesn’t know is looked up again without its last subtag until there’s nothing left to drop, so "de-AT" gets German quotes, "zh-Hant-TW" gets Traditional Chinese corner brackets, and a language it doesn’t know at all gets American-style ones. Straight double quotes are always educated into the outer pair and straight single quotes into the inner pair, so under "en-GB", "this" becomes ‘this’. Apostrophes are ’ everywhere.
+func OptionsForLanguage(tag string) Options {
+	opts := DefaultOptions()
+
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	quotes, ok := languageQuotes[tag]
+	for !ok {
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			return opts
+		}
+		tag = tag[:i]
+		quotes, ok = languageQuotes[tag]
+	}
+
+	opts.OpenDouble, opts.CloseDouble, opts.OpenSingle, opts.CloseSingle = quotes[0], quotes[1], quotes[2], quotes[3]
+	return opts
+}
+
+// GermanOptions returns DefaultOptions with German quote marks: „…“ outside and ‚…‘ inside. It’s the same as OptionsForLanguage("de"), for when you’d rather not spell out a language tag. Quotations close with CloseDouble and CloseSingle rather than a hardcoded ” or ’, so closing them with “ and ‘ works fine even though that’s what English opens with.
+func GermanOptions() Options {
+	return OptionsForLanguage("de")
+}
+
+// FrenchOptions returns DefaultOptions with French quote marks, «…» outside and “…” inside, and a narrow no-break space (U+202F) just inside the guillemets, so "Bonjour" becomes «\u202FBonjour\u202F». OptionsForLanguage("fr") doesn’t add the spaces, since not everyone writing French wants them, and Swiss French usually goes without; on the command line, -guillemet-space adds them.
+func FrenchOptions() Options {
+	opts := OptionsForLanguage("fr")
+	opts.GuillemetSpace = '\u202F'
+	return opts
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestOptionsForLanguage(t *testing.T) {
+	in := `"It's 'here'," she said.`
+
+	rows := []struct {
+		Tag  string
+		Want string
+	}{
+		{"en", `“It’s ‘here’,” she said.`},
+		{"en-US", `“It’s ‘here’,” she said.`},
+		{"en-GB", `‘It’s “here”,’ she said.`},
+		{"de", `„It’s ‚here‘,“ she said.`},
+		{"de-AT", `„It’s ‚here‘,“ she said.`},
+		{"fr", `«It’s “here”,» she said.`},
+		{"fr_CH", `«It’s ‹here›,» she said.`},
+		{"es", `«It’s “here”,» she said.`},
+		{"ja", `「It’s 『here』,」 she said.`},
+		{"zh", `“It’s ‘here’,” she said.`},
+		{"zh-TW", `「It’s 『here』,」 she said.`},
+		{"zh-Hant-TW", `「It’s 『here』,」 she said.`},
+		{"zh-Hans-CN", `“It’s ‘here’,” she said.`},
+		{"tlh", `“It’s ‘here’,” she said.`},
+		{"", `“It’s ‘here’,” she said.`},
+	}
+
+	for _, row := range rows {
+		t.Run(row.Tag, func(t *testing.T) {
+			got, err := EducateStringWithOptions(in, quotes.OptionsForLanguage(row.Tag))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != row.Want {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.Want, got)
+			}
+		})
+	}
+}
+
+func TestGermanOptions(t *testing.T) {
+	opts := quotes.GermanOptions()
+	opts.SmartNesting = true
+
+	rows := []Row{
+		{`Er sagte "Hallo".`, `Er sagte „Hallo“.`},
+		{`Er sagte 'Hallo'.`, `Er sagte ‚Hallo‘.`},
+		{`"Sie sagte 'Hallo', oder?"`, `„Sie sagte ‚Hallo‘, oder?“`},
+		{`"Sie sagte "Er sagte "ja"" gestern"`, `„Sie sagte ‚Er sagte „ja“‘ gestern“`},
+		{`"Das geht's nicht", sagte er.`, `„Das geht’s nicht“, sagte er.`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
+
+func TestFrenchOptions(t *testing.T) {
+	rows := []Row{
+		{`"Bonjour"`, "«\u202FBonjour\u202F»"},
+		{`Il a dit "C'est l'heure", puis il est parti.`, "Il a dit «\u202FC’est l’heure\u202F», puis il est parti."},
+		{`"Elle a dit 'non'."`, "«\u202FElle a dit “non”.\u202F»"},
+		{`" Bonjour "`, "«\u202FBonjour\u202F»"},
+		{"«\u00A0Bonjour\u00A0»", "«\u202FBonjour\u202F»"},
+		{"«\u202FBonjour\u202F»", "«\u202FBonjour\u202F»"},
+		{`Les "beaux jours" et les "grands"`, "Les «\u202Fbeaux jours\u202F» et les «\u202Fgrands\u202F»"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.FrenchOptions())
+}
+
+// TestEducatingTwice makes sure that educating already-educated text doesn’t change it, even when a language uses English’s opening quote marks to close its quotations, like German does with “ and ‘.
+func TestEducatingTwice(t *testing.T) {
+	in := `"It's 'here'," she said. "Yes."`
+
+	for _, tag := range []string{"en", "en-GB", "de", "fr", "fr-CH", "ja"} {
+		t.Run(tag, func(t *testing.T) {
+			opts := quotes.OptionsForLanguage(tag)
+			once, err := EducateStringWithOptions(in, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			twice, err := EducateStringWithOptions(once, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if twice != once {
+				t.Errorf("\nonce:  «%s»\ntwice: «%s»", once, twice)
+			}
+		})
+	}
+
+	testRowsWithOptions(t, []Row{
+		{`„Hallo" und "Welt"`, `„Hallo“ und „Welt“`},
+		{`„Er sagt ‚nein', oder?"`, `„Er sagt ‚nein‘, oder?“`},
+		{quotes.Straighten(`„It’s ‚here‘,“ she said.`), `„It’s ‚here‘,“ she said.`},
+	}, quotes.OptionsForLanguage("de"))
+
+	testRowsWithOptions(t, []Row{
+		{`«Bonjour" et "salut"`, `«Bonjour» et «salut»`},
+		{`«Il dit “non”, d'accord»`, `«Il dit “non”, d’accord»`},
+	}, quotes.OptionsForLanguage("fr"))
+}
+
+func TestCJKQuotes(t *testing.T) {
+	rows := []Row{
+		{`彼は"こんにちは"と言った。`, `彼は「こんにちは」と言った。`},
+		{`彼は'こんにちは'と言った。`, `彼は『こんにちは』と言った。`},
+		{`彼は"母が'ありがとう'と言った"と話した。`, `彼は「母が『ありがとう』と言った」と話した。`},
+		{`"It's"と言った`, `「It’s」と言った`},
+		{`钥匙在'桌子'上`, `钥匙在『桌子』上`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.OptionsForLanguage("ja"))
+
+	testRowsWithOptions(t, []Row{
+		{`他说'你好'。`, `他说‘你好’。`},
+		{`他说"我说'你好'"。`, `他说“我说‘你好’”。`},
+	}, quotes.OptionsForLanguage("zh"))
+
+	testRowsWithOptions(t, []Row{
+		{`그는 'ㅋ'라고 했다`, `그는 ‘ㅋ’라고 했다`},
+	}, quotes.DefaultOptions())
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+)
+
+// latexVerbatimEnvironments are the environments whose contents are copied as-is, like code blocks.
+var latexVerbatimEnvironments = []string{"verbatim", "verbatim*", "lstlisting", "minted", "comment"}
+
+// registerLaTeX swaps the Markdown-and-HTML-specific callbacks for LaTeX ones.
+func registerLaTeX(s *state) {
+	delete(s.whatDo, '<') // LaTeX doesn’t have HTML
+
+	s.whatDo['\\'] = atLaTeXBackslash
+	s.whatDo['$'] = atLaTeXDollar
+	s.whatDo['%'] = atLaTeXPercent
+	s.whatDo['`'] = atLaTeXGrave
+	s.whatDo['\''] = atLaTeXSingleQuote
+}
+
+// atLaTeXBackslash reads an assumed-to-exist \ and copies whatever it starts that shouldn’t be educated: \(…\) and \[…\] math, \verb|…|, and verbatim environments. Anything else gets treated like a Markdown backslash escape, so «\'e» stays as it is and the {It's} in «\emph{It's}» gets educated.
+func atLaTeXBackslash(s *state) error {
+	r := s.mustReadRune()
+	if r != '\\' {
+		return fmt.Errorf("expecting a backslash. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	switch {
+	case s.PeekEquals("("):
+		return s.AdvanceThrough(`\)`)
+	case s.PeekEquals("["):
+		return s.AdvanceThrough(`\]`)
+	case s.PeekEquals("verb"):
+		if err := s.AdvanceBy(len("verb")); err != nil {
+			return err
+		}
+		if s.PeekEquals("*") {
+			if err := s.AdvanceBy(1); err != nil {
+				return err
+			}
+		}
+		delimiter, err := s.readRune()
+		if err != nil {
+			return err
+		}
+		s.writeRune(delimiter)
+		return s.AdvanceThrough(string(delimiter))
+	}
+
+	for _, environment := range latexVerbatimEnvironments {
+		if s.PeekEquals("begin{" + environment + "}") {
+			return s.AdvanceThrough(`\end{` + environment + "}")
+		}
+	}
+
+	r, err := s.readRune()
+	if err != nil {
+		return err
+	}
+	return s.writeRune(r)
+}
+
+// atLaTeXDollar reads an assumed-to-exist $ and copies the $…$ or $$…$$ math it starts.
+func atLaTeXDollar(s *state) error {
+	r := s.mustReadRune()
+	if r != '$' {
+		return fmt.Errorf("expecting a dollar sign. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	if s.PeekEquals("$") {
+		if err := s.AdvanceBy(1); err != nil {
+			return err
+		}
+		return s.AdvanceThrough("$$")
+	}
+
+	if !s.unescapedRuneAhead('$') {
+		return nil
+	}
+	return inSpanEndingWithSingleUnescapedRune(s, '$')
+}
+
+// atLaTeXPercent reads an assumed-to-exist % and copies the comment it starts, up to the end of the line.
+func atLaTeXPercent(s *state) error {
+	r := s.mustReadRune()
+	if r != '%' {
+		return fmt.Errorf("expecting a percent sign. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	return s.AdvanceUntil("\n")
+}
+
+// atLaTeXGrave reads an assumed-to-exist `, LaTeX’s opening single quote, or the first of a pair of them, LaTeX’s opening double quote. They’re copied as-is unless LaTeXQuotes is set.
+func atLaTeXGrave(s *state) error {
+	r := s.mustReadRune()
+	if r != '`' {
+		return fmt.Errorf("expecting a backtick. got: «%s» (%U)", string(r), r)
+	}
+
+	if s.PeekEquals("`") {
+		if !s.opts.LaTeXQuotes {
+			s.writeRune(r)
+			return s.AdvanceBy(1)
+		}
+		start := s.currentOffset() - 1
+		if err := s.skip(1); err != nil {
+			return err
+		}
+		return s.replace(start, string(s.opts.OpenDouble))
+	}
+
+	if !s.opts.LaTeXQuotes {
+		return s.writeRune(r)
+	}
+	return s.substitute(r, s.opts.OpenSingle)
+}
+
+// atLaTeXSingleQuote reads an assumed-to-exist ' or ‘. If it’s the first of two ' in a row, LaTeX’s closing double quote, both are copied as-is (or turned into a CloseDouble if LaTeXQuotes is set). Otherwise, it’s educated like any other single quote.
+func atLaTeXSingleQuote(s *state) error {
+	if !s.PeekEquals("''") {
+		return atSingleQuote(s)
+	}
+
+	r := s.mustReadRune()
+	if !s.opts.LaTeXQuotes {
+		s.writeRune(r)
+		return s.AdvanceBy(1)
+	}
+	start := s.currentOffset() - 1
+	if err := s.skip(1); err != nil {
+		return err
+	}
+	return s.replace(start, string(s.opts.CloseDouble))
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestLaTeX(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.LaTeX = true
+
+	paragraph := "It's ``quoted'' and \"curled\", but $f'(x) = \"a\"$ and \\(g''\\) aren't, % it's a comment\nnor is \\verb|'this'| or\n\\begin{verbatim}\nprint(\"it's\")\n\\end{verbatim}\nThat's \\emph{`it'}, \\'etude. $$x' = y''$$ <b>'hi'</b>"
+
+	rows := []Row{
+		{
+			paragraph,
+			"It’s ``quoted'' and “curled”, but $f'(x) = \"a\"$ and \\(g''\\) aren’t, % it's a comment\nnor is \\verb|'this'| or\n\\begin{verbatim}\nprint(\"it's\")\n\\end{verbatim}\nThat’s \\emph{`it’}, \\'etude. $$x' = y''$$ <b>‘hi’</b>",
+		},
+		{"Costs \\$5, it's \"cheap\".", "Costs \\$5, it’s “cheap”."},
+		{"100\\% it's \"true\".", "100\\% it’s “true”."},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	opts.LaTeXQuotes = true
+	testRowsWithOptions(t, []Row{
+		{"``It's `here','' he said. $a''$", "“It’s ‘here’,” he said. $a''$"},
+	}, opts)
+
+	// Dashes work in LaTeX documents, too, and a --- at the start isn’t front matter
+	opts.Dashes = true
+	opts.NumberRangeDashes = true
+	testRowsWithOptions(t, []Row{
+		{"It's -- \"here\" --- see pages 10-20.", "It’s – “here” — see pages 10–20."},
+		{"---\n'Dash' $a-b$", "---\n‘Dash’ $a-b$"},
+	}, opts)
+}
+
+// TestQuotedLaTeXMath makes sure a quotation can open before inline math and close after it without the math’s own primes and quotes getting curled or throwing off which quote comes next.
+func TestQuotedLaTeXMath(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.LaTeX = true
+
+	rows := []Row{
+		{`"the formula $x='y'$ is simple"`, `“the formula $x='y'$ is simple”`},
+		{`"the formula $x="y"$ is simple"`, `“the formula $x="y"$ is simple”`},
+		{`'so $f'(x)$ is' it`, `‘so $f'(x)$ is’ it`},
+		{`"see $$a'' = b$$" and "\(c'\)"`, `“see $$a'' = b$$” and “\(c'\)”`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// A Diagnostic is something EducateAndLint noticed about its input. Whether it got fixed depends on the Options.
+type Diagnostic struct {
+	// Line and Column are 1-based. Column counts runes, not bytes.
+	Line, Column int
+
+	// Offset is the byte offset into the input.
+	Offset int
+
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// EducateAndLint is like EducateWithOptions, but also returns Diagnostics for every run of two or more spaces after a sentence’s ., ?, or ! in prose. Code, HTML tags, and front matter aren’t prose, so they aren’t checked.
+//
+// If opts.CollapseSpaces is set, the flagged spaces are collapsed, too.
+func EducateAndLint(out io.Writer, in *bytes.Reader, opts Options) ([]Diagnostic, error) {
+	s, err := newState(in, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lint = true
+	if _, ok := s.whatDo[' ']; !ok {
+		s.whatDo[' '] = atSpace
+	}
+
+	err = initial(&s)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	_, err = s.WriteTo(out)
+	return s.diagnostics, err
+}
+
+// diagnose records a Diagnostic for the input at offset.
+func (s *state) diagnose(offset int64, message string) {
+	line, column := s.position(offset)
+	s.diagnostics = append(s.diagnostics, Diagnostic{
+		Line:    line,
+		Column:  column,
+		Offset:  int(offset),
+		Message: message,
+	})
+}
+
+// position returns the 1-based line and column of offset in the input, counting the column in runes.
+func (s *state) position(offset int64) (line, column int) {
+	before := s.src[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return bytes.Count(before, []byte("\n")) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateAndLint(t *testing.T) {
+	rows := []struct {
+		In              string
+		Want            string
+		WantDiagnostics []quotes.Diagnostic
+	}{
+		{
+			"Hi.  There",
+			"Hi.  There",
+			[]quotes.Diagnostic{{Line: 1, Column: 4, Offset: 3, Message: "2 spaces after a sentence"}},
+		},
+		{
+			"Why?   Because.\n“Yes!”  No.  It's over!  ",
+			"Why?   Because.\n“Yes!”  No.  It’s over!  ",
+			[]quotes.Diagnostic{
+				{Line: 1, Column: 5, Offset: 4, Message: "3 spaces after a sentence"},
+				{Line: 2, Column: 12, Offset: 31, Message: "2 spaces after a sentence"},
+			},
+		},
+		{
+			"Word  word. Fine.",
+			"Word  word. Fine.",
+			nil,
+		},
+		{
+			"`a.  b` and\n\n```\nx.  y\n```\n<p title=\"a.  b\">ok</p>",
+			"`a.  b` and\n\n```\nx.  y\n```\n<p title=\"a.  b\">ok</p>",
+			nil,
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			var out strings.Builder
+			diagnostics, err := quotes.EducateAndLint(&out, bytes.NewReader([]byte(row.In)), quotes.DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != row.Want {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.Want, out.String())
+			}
+			if !reflect.DeepEqual(diagnostics, row.WantDiagnostics) {
+				t.Errorf("\nexpected diagnostics: %v\ngot:                  %v", row.WantDiagnostics, diagnostics)
+			}
+		})
+	}
+}
+
+func TestEducateAndLintCollapsesSpaces(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.CollapseSpaces = true
+
+	var out strings.Builder
+	diagnostics, err := quotes.EducateAndLint(&out, bytes.NewReader([]byte("Hi.  There.")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hi. There."; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+	if len(diagnostics) != 1 || diagnostics[0].String() != "1:4: 2 spaces after a sentence" {
+		t.Errorf("expected one diagnostic at 1:4, got %v", diagnostics)
+	}
+}
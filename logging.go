@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+)
+
+// A LogEntry is something Educate would’ve logged, for Options.Log.
+type LogEntry struct {
+	// Kind is what sort of thing it is, like LogAmbiguousQuote.
+	Kind string `json:"kind"`
+
+	// Line and Column are 1-based, like a Diagnostic’s, and Offset is the byte offset into the input.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+
+	Message string `json:"message"`
+}
+
+// These are the kinds of LogEntry there are.
+const (
+	LogAmbiguousQuote = "ambiguous-quote" // an ' that could be a quote mark or an apostrophe, so it was left straight
+	LogUnexpected     = "unexpected"      // something that shouldn’t happen, like a failed read of input that’s already in memory
+	LogPostcondition  = "postcondition"   // the HTML parser ended up somewhere it didn’t think it could, so Educate gave up
+)
+
+// logf logs things worth double-checking in the output, unless Options.Quiet says not to. They go to Options.Log if it’s set, and through the log package if it isn’t.
+func (s *state) logf(kind string, offset int64, format string, v ...interface{}) {
+	if s.opts.Quiet {
+		return
+	}
+
+	message := fmt.Sprintf(format, v...)
+	if s.opts.Log == nil {
+		log.Print(message)
+		return
+	}
+
+	line, column := s.position(offset)
+	s.opts.Log(LogEntry{Kind: kind, Line: line, Column: column, Offset: int(offset), Message: message})
+}
+
+// jsonLog returns an Options.Log that writes each LogEntry to w as a line of JSON, for log aggregators that don’t want to parse prose.
+func jsonLog(w io.Writer) func(LogEntry) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return func(entry LogEntry) {
+		if err := encoder.Encode(entry); err != nil {
+			log.Printf("Couldn’t write log entry as JSON: %v", err)
+		}
+	}
+}
@@ -3,13 +3,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"os"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -21,12 +27,270 @@ type state struct {
 	r *bytes.Reader
 	w bytes.Buffer
 
+	// src holds everything r reads from, for looking far ahead without disturbing r.
+	src []byte
+
+	// start is where the document proper starts in r, which is just past the byte-order mark if there is one.
+	start int64
+
 	whatDo map[rune]callback
 
+	opts Options
+
+	// codeElementsEntered counts the raw-text elements (code, by default) we’re inside of, and codeElement is the name of the outermost one.
 	codeElementsEntered int
+	codeElement         string
+
+	// doubleQuotesOpen and singleQuotesOpen count the quotations we’re inside of.
+	doubleQuotesOpen, singleQuotesOpen int
+
+	// changes counts the runes that were written differently from how they were read, and edits says where they were, if recordEdits is set.
+	changes     int
+	recordEdits bool
+	edits       []Edit
+
+	// countOnly is set by CountChanges, which only wants changes counted. Then w only holds the line being written (see dropWrittenLines), since nothing looks back further than that.
+	countOnly bool
+
+	// lint is set by EducateAndLint, which wants diagnostics collected along the way.
+	lint        bool
+	diagnostics []Diagnostic
+}
+
+// These are the characters Educate writes with DefaultOptions, plus a few that go along with them that it only writes when Options asks for them. They’re here so that anything checking for educated text doesn’t have to spell out the runes itself.
+const (
+	LeftDoubleQuote  = '“' // U+201C LEFT DOUBLE QUOTATION MARK
+	RightDoubleQuote = '”' // U+201D RIGHT DOUBLE QUOTATION MARK
+	LeftSingleQuote  = '‘' // U+2018 LEFT SINGLE QUOTATION MARK
+	RightSingleQuote = '’' // U+2019 RIGHT SINGLE QUOTATION MARK
+	Apostrophe       = '’' // U+2019 RIGHT SINGLE QUOTATION MARK, same as RightSingleQuote, which is what everyone uses
+	Prime            = '′' // U+2032 PRIME
+	DoublePrime      = '″' // U+2033 DOUBLE PRIME
+	EmDash           = '—' // U+2014 EM DASH
+	EnDash           = '–' // U+2013 EN DASH
+	Ellipsis         = '…' // U+2026 HORIZONTAL ELLIPSIS
+)
+
+// Options controls what Educate writes.
+//
+// The zero value isn’t useful, since it’d have Educate write NUL characters instead of quote marks, and its empty SkipContexts would have it curl the quotes in code, too. Start with DefaultOptions and change what you need to.
+type Options struct {
+	// OpenDouble and CloseDouble are written at the start and end of a double-quoted quotation.
+	OpenDouble, CloseDouble rune
+
+	// OpenSingle and CloseSingle are written at the start and end of a single-quoted quotation.
+	OpenSingle, CloseSingle rune
+
+	// Apostrophe is written for ' in contractions, possessives, and the like. It doesn’t need to match either CloseSingle or OpenSingle.
+	Apostrophe rune
+
+	// GuillemetSpace, if it isn’t zero, is written just inside double-quoted quotations, after OpenDouble and before CloseDouble, for French-style «\u202FBonjour\u202F». Spaces that are already there, like the ones in «" Bonjour "», are replaced with it instead of doubled up.
+	GuillemetSpace rune
+
+	// ResolveSingleQuote decides whether a single quote mark opens a quotation, closes one, or is an apostrophe. If it’s nil, DefaultResolveSingleQuote decides.
+	//
+	// It only gets asked about the hard cases. Quotes in URLs, primes, and elisions like 'tis and rock 'n' roll are all taken care of before it’s called.
+	ResolveSingleQuote func(ctx QuoteContext) QuoteKind
+
+	// InitialQuoteState says whether the input starts in the middle of a quotation, for educating a fragment of a longer document that got cut off partway through one. Then the first closing quote mark closes it, instead of an opening one opening a new one.
+	InitialQuoteState QuoteState
+
+	// HeadingQuoteStyle is how quotes are written in Markdown headings, like «# "Headline"», and in a first paragraph that’s only one line long, since that’s probably a title, too.
+	HeadingQuoteStyle HeadingQuoteStyle
+
+	// SmartNesting turns a straight-double-quoted quotation inside another one into a single-quoted one, so «"She said "hi" to me"» becomes «“She said ‘hi’ to me”». Quotations nested deeper than that alternate back and forth. A " is taken to open a nested quotation when there’s a space before it and none after it.
+	SmartNesting bool
+
+	// FlattenNesting writes every quotation with OpenDouble and CloseDouble, even single-quoted ones and ones nested inside others, for house styles that never alternate. Apostrophes are still written with Apostrophe.
+	FlattenNesting bool
+
+	// LegacyGraveQuotes treats a ` as an opening single quote, for old plain-text documents written `like this'. Fenced code blocks are still code, but there aren’t any code spans, since their backticks are quotes now.
+	LegacyGraveQuotes bool
+
+	// Fractions turns 1/2, 1/4, and 3/4 into ½, ¼, and ¾ when they aren’t part of a bigger number, a date, or a path.
+	Fractions bool
+
+	// CollapseSpaces turns runs of spaces in prose into single spaces. Indentation, the two trailing spaces of a Markdown hard line break, and anything in code or inside HTML tags are left alone.
+	CollapseSpaces bool
+
+	// Primes turns a straight ' or " right after a digit into a prime (′) or double prime (″), as in «5′ 10″». Inside a quotation, a " after a digit is only taken as a double prime if the quotation looks like it gets closed later on in the paragraph. It’s off by default, since that check is easily fooled by a quotation that ends in a number, like «"Top 10" lists are "fun"».
+	Primes bool
+
+	// NumberRangeDashes turns the hyphen in a number range, like «pages 10-20» or «2019-2023», into an en dash. Dates like 2019-10-14, phone numbers like 555-1234, and numbers glued to letters or other punctuation are left alone.
+	NumberRangeDashes bool
+
+	// Dashes turns a -- standing in for a dash into an en dash and a --- into an em dash, as long as it has spaces on both sides (like «this -- that») or word characters on both sides (like «1914--1918» and «one---two»). Command-line flags like «--verbose», horizontal rules, and four or more hyphens in a row are left alone.
+	Dashes bool
+
+	// StripMarkdownEscapes drops the backslash from a Markdown backslash escape, like the one in «\"», and writes the escaped character as-is, straight quote marks and all. That’s what a Markdown renderer would show, but the result isn’t Markdown that means the same thing anymore (a «\*» becomes a «*» that starts emphasis), so it’s for text that’s done being Markdown. It doesn’t do anything in Typst documents.
+	StripMarkdownEscapes bool
+
+	// CodeLikeWords leaves a ' straight when it’s in the middle of a word that looks like an identifier instead of prose, like «it's_a_var» or «don't()». A word looks like one if it has an underscore in it, a ( right after a letter, digit, or underscore, or a . between one of those and a lowercase letter. Periods at the ends of sentences and parenthetical asides like «(don't)» don’t count.
+	CodeLikeWords bool
+
+	// Ellipses turns exactly three periods in a row, like the ones in «Wait...», into an ellipsis (…). Four or more are left alone, since they’re usually there on purpose, and so are the ones in URLs and paths.
+	Ellipses bool
+
+	// RawTextElements names the HTML elements whose contents are left alone, like code, kbd, and samp. They hold things people type and things computers print, where straight quotes are part of the text.
+	RawTextElements []string
+
+	// NoHTML makes every < just a <, for Markdown that never has any HTML in it, so «a <b "c"» can’t be taken for a tag. Autolinks aren’t special, either, so quotes in their URLs get curled.
+	NoHTML bool
+
+	// SVGText educates the prose in inline SVG’s <text> elements, <tspan>s and all. The rest of an <svg> is left alone either way, like path data and styles are.
+	SVGText bool
+
+	// Lenient makes Educate carry on as if nothing happened when something can’t be parsed the way it’s supposed to, like a <code> start tag without a matching end tag. Otherwise, Educate returns an error, since the alternative is silently leaving the rest of the document alone.
+	Lenient bool
+
+	// Typst treats the input as a Typst document instead of Markdown: comments, #code, and $math$ are left alone, along with raw text in backticks. Prose in content blocks, like the [It's] in «#emph[It's]», is still educated.
+	Typst bool
+
+	// LaTeX treats the input as a LaTeX document instead of Markdown: comments, math, \verb, and verbatim environments are left alone, and so are LaTeX’s own `` and '' quotes.
+	LaTeX bool
+
+	// Djot treats the input as a Djot document instead of Markdown: verbatim spans go on to the end of the paragraph if they’re never closed, attributes like «{title="It's"}» are left alone, and there’s no HTML or front matter to worry about.
+	Djot bool
+
+	// LaTeXQuotes turns LaTeX’s ``, '', and ` quotes into OpenDouble, CloseDouble, and OpenSingle. It doesn’t do anything unless LaTeX is set, too.
+	LaTeXQuotes bool
+
+	// Quiet keeps Educate from logging the things it isn’t sure about, like whether the ' in «)'» is a quote mark or an apostrophe.
+	Quiet bool
+
+	// Log, if set, gets everything Educate logs instead of the log package, with where in the input it happened.
+	Log func(LogEntry)
+
+	// WriteBOM writes a UTF-8 byte-order mark at the start of the output. A byte-order mark at the start of the input is always dropped, so this is how you keep one.
+	WriteBOM bool
+
+	// SkipContexts lists the places where Educate leaves everything alone. DefaultOptions skips all of them, and taking one out has it educated like prose, so without ContextInlineCode, the quotes in «`'x'`» get curled, backticks and all. A nil or empty SkipContexts skips nothing at all.
+	SkipContexts []Context
+
+	// TemplateDelimiters lists template-tag openers and their closers, one after the other, like {"{{", "}}", "{%", "%}"} for Liquid or Handlebars. Everything from an opener through its closer is written as-is.
+	TemplateDelimiters []string
+}
+
+// DefaultOptions returns the Options that Educate uses: American-style curly quotes.
+func DefaultOptions() Options {
+	return Options{
+		OpenDouble:  LeftDoubleQuote,
+		CloseDouble: RightDoubleQuote,
+		OpenSingle:  LeftSingleQuote,
+		CloseSingle: RightSingleQuote,
+		Apostrophe:  Apostrophe,
+
+		RawTextElements: []string{"code", "kbd", "samp"},
+		SkipContexts:    []Context{ContextInlineCode, ContextCodeBlock, ContextHTMLAttr, ContextYAML, ContextScript},
+	}
+}
+
+// A Context is a kind of place in a document that isn’t prose, like a code span. Options.SkipContexts says which ones Educate leaves alone.
+type Context int
+
+const (
+	ContextInlineCode Context = iota // a `code span`
+	ContextCodeBlock                 // a ``` fenced code block
+	ContextHTMLAttr                  // a quoted HTML attribute value, like the «it's» in «<p title="it's">»; the quote marks around it are always left straight
+	ContextYAML                      // YAML front matter
+	ContextScript                    // anything inside one of the Options.RawTextElements, like <code>, and inline <svg> (except for its <text>, if Options.SVGText is set)
+)
+
+// contextNames are what Context.String returns.
+var contextNames = [...]string{"inline-code", "code-block", "html-attr", "yaml", "script"}
+
+func (c Context) String() string {
+	if c < 0 || int(c) >= len(contextNames) {
+		return fmt.Sprintf("Context(%d)", int(c))
+	}
+	return contextNames[c]
+}
+
+// A QuoteContext is what ResolveSingleQuote gets to go on.
+type QuoteContext struct {
+	// Quote is the quote mark in question: ', ‘, or ’.
+	Quote rune
+
+	// Previous and Next are the runes on either side of Quote, or 0 at the start or end of the document.
+	Previous, Next rune
+
+	// InSingleQuotes and InDoubleQuotes say whether Quote is inside a quotation already.
+	InSingleQuotes, InDoubleQuotes bool
+}
+
+// A QuoteKind is what ResolveSingleQuote decides a single quote mark is.
+type QuoteKind int
+
+const (
+	QuoteOpening QuoteKind = iota
+	QuoteClosing
+	QuoteApostrophe
+)
+
+// A QuoteState is what kind of quotation, if any, Educate is in the middle of.
+type QuoteState int
+
+const (
+	OutsideQuotes QuoteState = iota
+	InsideDoubleQuotes
+	InsideSingleQuotes
+)
+
+// A HeadingQuoteStyle is a way to write quotes in headlines that some publications use.
+type HeadingQuoteStyle int
+
+const (
+	HeadingQuotesLikeBody HeadingQuoteStyle = iota // the same as everywhere else
+	HeadingQuotesStraight                          // straight quotes and apostrophes, nothing curled
+	HeadingQuotesSingle                            // single quotes outside and double quotes inside, newspaper-headline style
+)
+
+// headingOptions returns the Options for educating a heading in opts.HeadingQuoteStyle.
+func headingOptions(opts Options) Options {
+	switch opts.HeadingQuoteStyle {
+	case HeadingQuotesStraight:
+		opts.OpenDouble, opts.CloseDouble = '"', '"'
+		opts.OpenSingle, opts.CloseSingle, opts.Apostrophe = '\'', '\'', '\''
+		opts.Primes = false
+	case HeadingQuotesSingle:
+		opts.OpenDouble, opts.CloseDouble, opts.OpenSingle, opts.CloseSingle = opts.OpenSingle, opts.CloseSingle, opts.OpenDouble, opts.CloseDouble
+	}
+	return opts
+}
+
+// DefaultResolveSingleQuote is what Educate uses when Options.ResolveSingleQuote is nil.
+//
+// Inside a single-quoted quotation, a ' or ’ with letters on both sides, like the ones in «don't» and «o'clock», is an apostrophe, a ' with a space or an opening bracket before it and a letter after it opens a quotation inside that one, like the second one in «'it's a 'nested' thing'», and anything else closes the quotation. Outside of one, a quote right after a letter is an apostrophe, and anything else opens a new quotation. A ‘ always opens one unless it’s right after a letter.
+//
+// Chinese, Japanese, and Korean letters don’t count, since those languages don’t have apostrophes, and their quotations usually come right after a letter, like the one in «彼は'こんにちは'と言った».
+func DefaultResolveSingleQuote(ctx QuoteContext) QuoteKind {
+	// «the 1990's» and «all the 4's»
+	if unicode.IsDigit(ctx.Previous) && takesApostrophes(ctx.Next) && ctx.Quote != '‘' {
+		return QuoteApostrophe
+	}
+
+	if ctx.InSingleQuotes && ctx.Quote != '‘' {
+		if takesApostrophes(ctx.Previous) && takesApostrophes(ctx.Next) {
+			return QuoteApostrophe
+		}
+		if ctx.Quote == '\'' && (unicode.IsSpace(ctx.Previous) || isOpeningPunctuation(ctx.Previous)) && takesApostrophes(ctx.Next) {
+			return QuoteOpening
+		}
+		return QuoteClosing
+	}
+
+	if takesApostrophes(ctx.Previous) {
+		return QuoteApostrophe
+	}
+	return QuoteOpening
 }
 
-func newState(whence *bytes.Reader) (state, error) {
+// takesApostrophes returns true if r is a letter in a script that has apostrophes, which is every script but the CJK ones.
+func takesApostrophes(r rune) bool {
+	return unicode.IsLetter(r) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo)
+}
+
+func newState(whence *bytes.Reader, opts Options) (state, error) {
 	var s state
 
 	if whence == nil {
@@ -35,21 +299,89 @@ func newState(whence *bytes.Reader) (state, error) {
 
 	s.r = whence
 
+	s.src = make([]byte, whence.Size())
+	if _, err := whence.ReadAt(s.src, 0); err != nil && err != io.EOF {
+		return s, err
+	}
+	s.opts = opts
+	if s.opts.ResolveSingleQuote == nil {
+		s.opts.ResolveSingleQuote = DefaultResolveSingleQuote
+	}
+	if opts.FlattenNesting {
+		s.opts.OpenSingle, s.opts.CloseSingle = opts.OpenDouble, opts.CloseDouble
+	}
+
+	// A byte-order mark isn’t part of the document, so don’t let it get in the way of front-matter detection and the like.
+	if r, _, err := s.r.ReadRune(); err == nil && r != '\uFEFF' {
+		s.r.UnreadRune()
+	}
+	s.start = s.currentOffset()
+
 	s.whatDo = make(map[rune]callback)
 
 	s.whatDo['\\'] = atBackslash
 
 	s.whatDo['"'] = atDoubleQuote
-	s.whatDo['“'] = atDoubleQuote
-
 	s.whatDo['\''] = atSingleQuote
-	s.whatDo['‘'] = atSingleQuote
+
+	// Opening quote marks that are already curly start quotations, too, so educating something twice is the same as educating it once. That’s whatever the Options say the opening quote marks are (unless one’s also the apostrophe, since then there’s no telling which an already-curly one is), and ‘ and “ as long as the Options don’t use them for anything else, like German does.
+	s.whatDo[s.opts.OpenDouble] = atDoubleQuote
+	if _, ok := s.whatDo[s.opts.OpenSingle]; !ok && s.opts.OpenSingle != s.opts.Apostrophe {
+		s.whatDo[s.opts.OpenSingle] = atSingleQuote
+	}
+	if !s.opts.usesQuoteMark('“') {
+		s.whatDo['“'] = atDoubleQuote
+	}
+	if !s.opts.usesQuoteMark('‘') {
+		s.whatDo['‘'] = atSingleQuote
+	}
 
 	s.whatDo['-'] = atHyphen
 
 	s.whatDo['`'] = atBacktick
 
-	s.whatDo['<'] = atLessThan
+	if !opts.NoHTML {
+		s.whatDo['<'] = atLessThan
+	}
+
+	s.whatDo['['] = atOpenBracket
+
+	if opts.CollapseSpaces {
+		s.whatDo[' '] = atSpace
+	}
+
+	if opts.Ellipses {
+		s.whatDo['.'] = atPeriod
+	}
+
+	if opts.HeadingQuoteStyle != HeadingQuotesLikeBody {
+		s.whatDo['#'] = atHash
+	}
+
+	if opts.Fractions {
+		for fraction := range commonFractions {
+			s.whatDo[rune(fraction[0])] = atDigit
+		}
+	}
+
+	if opts.Typst {
+		registerTypst(&s)
+	}
+
+	if opts.LaTeX {
+		registerLaTeX(&s)
+	}
+
+	if opts.Djot {
+		registerDjot(&s)
+	}
+
+	// This goes last so template tags can fall back on whatever else starts with the same rune.
+	for i := 0; i+1 < len(opts.TemplateDelimiters); i += 2 {
+		opener, closer := opts.TemplateDelimiters[i], opts.TemplateDelimiters[i+1]
+		first, _ := utf8.DecodeRuneInString(opener)
+		s.whatDo[first] = atTemplateTag(opener, closer, s.whatDo[first])
+	}
 
 	return s, nil
 }
@@ -79,6 +411,35 @@ func (s *state) previousRune() (rune, error) {
 	return r, nil
 }
 
+// skips returns true if Options.SkipContexts says to leave c alone.
+func (s *state) skips(c Context) bool {
+	for _, skipped := range s.opts.SkipContexts {
+		if skipped == c {
+			return true
+		}
+	}
+	return false
+}
+
+// atStartOfLine returns true if nothing’s been written yet or the last rune written was a newline.
+func (s *state) atStartOfLine() bool {
+	r, err := s.previousRune()
+	return err != nil || r == '\n'
+}
+
+// onlyWhitespaceSoFarOnLine returns true if nothing but indentation comes before the rune just read on its line, so it’s the first thing on it, like a list marker would be.
+func (s *state) onlyWhitespaceSoFarOnLine() bool {
+	offset := s.currentOffset()
+	_, size := utf8.DecodeLastRune(s.src[s.start:offset])
+	return len(bytes.TrimSpace(s.lineBefore(offset-int64(size)))) == 0
+}
+
+// lineBefore returns the input from the start of the line offset is on up to offset. It looks at the input and not what’s been written, since what’s been written isn’t always all there (see dropWrittenLines) and doesn’t always line up with the input.
+func (s *state) lineBefore(offset int64) []byte {
+	bs := s.src[s.start:offset]
+	return bs[bytes.LastIndexByte(bs, '\n')+1:]
+}
+
 func (s *state) previousRuneMatches(f func(rune) bool) bool {
 	r, err := s.previousRune()
 	if err != nil {
@@ -89,7 +450,7 @@ func (s *state) previousRuneMatches(f func(rune) bool) bool {
 
 func (s *state) previousRuneMatchesAny(candidates ...rune) bool {
 	for _, candidate := range candidates {
-		if r, err := s.previousRune(); err != nil {
+		if r, err := s.previousRune(); err == nil {
 			if r == candidate {
 				return true
 			}
@@ -98,34 +459,240 @@ func (s *state) previousRuneMatchesAny(candidates ...rune) bool {
 	return false
 }
 
-func (s *state) previousRunesMatchOne(candidate string) bool {
+// afterClosingPunctuation returns true if the last thing written was closing punctuation (see isClosingPunctuation) or an HTML end tag, like the </b> in «<b>(x)</b>», which closes things just the same.
+//
+// Any other >, like the end of the <p> in «<p>'Hi'», a blockquote’s «>'Hi'», or the stray one in «<p>1 >'s», isn’t closing anything.
+func (s *state) afterClosingPunctuation() bool {
+	return s.previousRuneMatches(isClosingPunctuation) || endTagSuffix(s.w.Bytes()) > 0
+}
+
+// letterBeforeEndTag returns true if the last thing written was one or more HTML end tags with a letter right before them, like the </a> in «<a>Mark Twain</a>».
+func (s *state) letterBeforeEndTag() bool {
+	bs := s.w.Bytes()
+	sawEndTag := false
+	for n := endTagSuffix(bs); n > 0; n = endTagSuffix(bs) {
+		bs = bs[:len(bs)-n]
+		sawEndTag = true
+	}
+	if !sawEndTag {
+		return false
+	}
+
+	r, size := utf8.DecodeLastRune(bs)
+	return size > 0 && unicode.IsLetter(r)
+}
+
+// endTagSuffix returns how many bytes long the HTML end tag at the end of bs is, like the </a> in «Twain</a>», or 0 if bs doesn’t end with one. Only a whole </name> counts, with nothing but whitespace between the name and the >, so the > in «</b> wrote >» isn’t the end of the </b>.
+func endTagSuffix(bs []byte) int {
+	i := bytes.LastIndexByte(bs, '<')
+	if i < 0 {
+		return 0
+	}
+	tag := bs[i:]
+	if len(tag) < 4 || tag[1] != '/' || !isASCIILetter(rune(tag[2])) || bytes.IndexByte(tag, '>') != len(tag)-1 {
+		return 0
+	}
+
+	j := 3
+	for j < len(tag)-1 && !isASCIIWhitespace(rune(tag[j])) {
+		j++
+	}
+	if bytes.IndexFunc(tag[j:len(tag)-1], func(r rune) bool { return !isASCIIWhitespace(r) }) >= 0 {
+		return 0
+	}
+	return len(tag)
+}
+
+// wordBefore returns the runes just before the current position in the output, stopping at whitespace or the edge of an HTML tag.
+func (s *state) wordBefore() string {
 	bs := s.w.Bytes()
-	n := utf8.RuneCountInString(candidate)
-	puddle := make([]rune, n)
+	i := len(bs)
+	for i > 0 {
+		r, size := utf8.DecodeLastRune(bs[:i])
+		if isWordBoundary(r) {
+			break
+		}
+		i -= size
+	}
+	return string(bs[i:])
+}
 
-	for ; n > 0; n-- {
-		r, size := utf8.DecodeLastRune(bs)
-		if size == 0 {
+// wordAfter returns the runes that will be read next, stopping at whitespace or the edge of an HTML tag. The current offset is left where it was.
+func (s *state) wordAfter() string {
+	start := s.currentOffset()
+	defer s.r.Seek(start, io.SeekStart)
+
+	var b strings.Builder
+	for {
+		r, _, err := s.r.ReadRune()
+		if err != nil || isWordBoundary(r) {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// straightQuoteIsPrime returns true if Options.Primes is on and the just-read straight quote r comes right after a digit and is being used as a prime (for feet or minutes) or a double prime (for inches or seconds).
+//
+// A ' followed by a letter, as in «1990's», isn’t a prime. If we’re inside a quotation that r could close, r is only a prime if something else that could close the quotation shows up later in the paragraph, so the " in «"I’m 6' 2"» closes the quote but the first " in «"I’m 6' 2" tall"» doesn’t.
+func (s *state) straightQuoteIsPrime(r rune) bool {
+	if !s.opts.Primes || !s.previousRuneMatches(unicode.IsDigit) {
+		return false
+	}
+
+	var open int
+	var closers string
+	switch r {
+	case '\'':
+		if next, err := s.peekRune(); err == nil && unicode.IsLetter(next) {
 			return false
 		}
+		open, closers = s.singleQuotesOpen, "'’"
+	case '"':
+		open, closers = s.doubleQuotesOpen, `"”`
+	default:
+		return false
+	}
+
+	if open == 0 {
+		return true
+	}
+
+	paragraph := s.src[s.currentOffset():]
+	if end := bytes.Index(paragraph, []byte("\n\n")); end >= 0 {
+		paragraph = paragraph[:end]
+	}
+	return bytes.ContainsAny(paragraph, closers)
+}
+
+// atPluralPossessive returns true if the ' just read, inside a single-quoted quotation, is more likely the apostrophe of a possessive like «James'» or «the Joneses'» than the end of the quotation. That’s when it comes after an s and before another word, and something further along in the paragraph looks like it closes the quotation before anything looks like it opens a new one, like in «'James' book is here,' she said».
+func (s *state) atPluralPossessive() bool {
+	if !s.previousRuneMatchesAny('s', 'S') || !s.PeekEquals(" ") {
+		return false
+	}
+	if next, err := s.peekRuneAt(1); err != nil || !unicode.IsLetter(next) {
+		return false
+	}
+
+	paragraph := s.src[s.currentOffset():]
+	if end := bytes.Index(paragraph, []byte("\n\n")); end >= 0 {
+		paragraph = paragraph[:end]
+	}
+
+	for i := 0; i < len(paragraph); {
+		r, size := utf8.DecodeRune(paragraph[i:])
+		if r != '\'' && r != '’' {
+			i += size
+			continue
+		}
 
-		puddle[n-1] = r
-		bs = bs[:len(bs)-size]
+		before, _ := utf8.DecodeLastRune(paragraph[:i])
+		after, _ := utf8.DecodeRune(paragraph[i+size:])
+		switch {
+		case unicode.IsSpace(before) && unicode.IsLetter(after):
+			return false // it opens something
+		case !unicode.IsSpace(before) && !unicode.IsLetter(after):
+			return true // it closes something
+		}
+		i += size
 	}
 
-	return string(puddle) == candidate
+	return false
 }
 
-func (s *state) previousRunesMatchAny(candidates ...string) (needle string, ok bool) {
-	for _, candidate := range candidates {
-		if s.previousRunesMatchOne(candidate) {
-			return candidate, true
+// commonElisions lists words that conventionally start with an apostrophe standing in for some missing letters, like «’twas» and «’em». An elision that ends with ' has lost letters at both ends, like the «’n’» in «rock ’n’ roll».
+var commonElisions = []string{"tis", "twas", "twere", "twill", "em", "cause", "til", "bout", "n'"}
+
+// peekingAtElision returns the one of the commonElisions (in any case) that’s just ahead of the current offset, as long as it isn’t merely the start of a longer word.
+func (s *state) peekingAtElision() (elision string, ok bool) {
+	for _, elision := range commonElisions {
+		buf := make([]byte, len(elision))
+		if n, _ := s.r.ReadAt(buf, s.currentOffset()); n < len(buf) || !strings.EqualFold(string(buf), elision) {
+			continue
+		}
+
+		if next, err := s.peekRuneAt(int64(len(elision))); err == nil && unicode.IsLetter(next) {
+			continue
 		}
+
+		return elision, true
 	}
 
 	return "", false
 }
 
+// peekingAtElidedYear returns true if what’s just ahead is a year or decade that’s lost its first two digits, like the «99» in «class of '99» or the «80s» in «the '80s».
+//
+// A number that’s quoted, like the «12» in «'12'», doesn’t count.
+func (s *state) peekingAtElidedYear() bool {
+	ahead := s.src[s.currentOffset():]
+	if len(ahead) < 2 || !isASCIIDigit(rune(ahead[0])) || !isASCIIDigit(rune(ahead[1])) {
+		return false
+	}
+
+	rest := ahead[2:]
+	if len(rest) > 0 && rest[0] == 's' {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return true
+	}
+
+	next, _ := utf8.DecodeRune(rest)
+	return !(unicode.IsLetter(next) || unicode.IsDigit(next) || next == '\'' || next == '’')
+}
+
+// writeElision writes an apostrophe and then reads and writes the given elision, as returned by peekingAtElision, writing apostrophes for any of its 's, too.
+func (s *state) writeElision(elision string) error {
+	s.substitute('\'', s.opts.Apostrophe)
+
+	for _, e := range elision {
+		r, err := s.readRune()
+		if err != nil {
+			return err
+		}
+
+		if e == '\'' {
+			s.substitute(r, s.opts.Apostrophe)
+			continue
+		}
+		s.writeRune(r)
+	}
+
+	return nil
+}
+
+// inURLOrEmailishWord returns true if a just-read quote mark sits in the middle (not at either end) of something that looks like a URL, a path, or an email address, like the ' in «o'brien@example.com». Quote marks there are best left straight.
+func (s *state) inURLOrEmailishWord() bool {
+	before := s.wordBefore()
+	if before == "" {
+		return false
+	}
+
+	after := s.wordAfter()
+	if after == "" {
+		return false
+	}
+
+	return looksLikeURLOrEmail(before + after)
+}
+
+// inCodeLikeWord returns true if a just-read ' comes right after a letter in a word that looks like an identifier (see looksLikeCode), like the ' in «it's_a_var».
+func (s *state) inCodeLikeWord() bool {
+	if !s.previousRuneMatches(unicode.IsLetter) {
+		return false
+	}
+
+	// wordAfter stops at parentheses, so the one in «don't()» has to be tacked back on
+	after := s.wordAfter()
+	if next, err := s.peekRuneAt(int64(len(after))); err == nil && next == '(' {
+		after += "("
+	}
+
+	return looksLikeCode(s.wordBefore() + after)
+}
+
 func (s *state) mustReadRune() rune {
 	r, err := s.readRune()
 	if err != nil {
@@ -175,12 +742,63 @@ func (s *state) PeekEquals(needle string) bool {
 
 	_, err := s.r.ReadAt(buf, s.currentOffset())
 	if err != nil && err != io.EOF {
-		log.Println("Unexpected non-EOF error in PeekEquals")
+		s.logf(LogUnexpected, s.currentOffset(), "Unexpected non-EOF error in PeekEquals: %v", err)
 	}
 
 	return bytes.Equal(nb, buf)
 }
 
+// peekEqualsFold is like PeekEquals, but ignores ASCII case, the way HTML tag names do.
+func (s *state) peekEqualsFold(needle string) bool {
+	ahead := s.src[s.currentOffset():]
+	return len(ahead) >= len(needle) && bytes.EqualFold(ahead[:len(needle)], []byte(needle))
+}
+
+// peekTagNameFold returns true if the next runes are the tag name name, in any case, and not just the start of a longer one, so "svg" matches «svg>» and «svg/>» but not «svgx>».
+func (s *state) peekTagNameFold(name string) bool {
+	ahead := s.src[s.currentOffset():]
+	return s.peekEqualsFold(name) && (len(ahead) == len(name) || endsTagName(ahead[len(name)]))
+}
+
+// peekRuneAt returns the rune that starts skip bytes past the current offset without reading anything.
+func (s *state) peekRuneAt(skip int64) (rune, error) {
+	buf := make([]byte, utf8.UTFMax)
+	n, err := s.r.ReadAt(buf, s.currentOffset()+skip)
+	if n == 0 {
+		return 0, err
+	}
+
+	r, _ := utf8.DecodeRune(buf[:n])
+	return r, nil
+}
+
+// skip reads n runes and drops them on the floor. It’s for when you’ve peeked at something you’re replacing.
+func (s *state) skip(n int) error {
+	for ; n > 0; n-- {
+		if _, err := s.readRune(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unescapedRuneAhead returns true if sentinel shows up somewhere after the current offset without a backslash right before it. It’s the lookahead counterpart to inSpanEndingWithSingleUnescapedRune.
+func (s *state) unescapedRuneAhead(sentinel rune) bool {
+	previous, _ := s.previousRune()
+
+	for bs := s.src[s.currentOffset():]; len(bs) > 0; {
+		r, size := utf8.DecodeRune(bs)
+		if r == sentinel && previous != '\\' {
+			return true
+		}
+		previous = r
+		bs = bs[size:]
+	}
+
+	return false
+}
+
 // AdvanceBy reads and writes n runes.
 func (s *state) AdvanceBy(n int) error {
 	for ; n > 0; n-- {
@@ -259,17 +877,52 @@ func (s *state) advanceOneMore(err error) error {
 }
 
 func (s *state) writeRune(r rune) error {
+	if r == '\n' && s.countOnly {
+		s.dropWrittenLines()
+	}
 	_, err := s.w.WriteRune(r)
 	return err
 }
 
-func (s *state) WriteTo(w io.Writer) (n int64, err error) {
-	return s.w.WriteTo(w)
+// dropWrittenLines throws away what’s been written so far, for CountChanges, except for a tag that isn’t over yet, like the «<p» in «<p\nclass="x">», so justAfterStartTag can still find its <.
+func (s *state) dropWrittenLines() {
+	bs := s.w.Bytes()
+	i := bytes.LastIndexByte(bs, '<')
+	if i < 0 || bytes.IndexByte(bs[i:], '>') >= 0 {
+		s.w.Reset()
+		return
+	}
+
+	tag := append([]byte(nil), bs[i:]...)
+	s.w.Reset()
+	s.w.Write(tag)
 }
 
-// A stateFunction specifies what to do to keep parsing the input given what’s come before.
-//
-// Conventions:
+// substitute writes replacement in place of original, the rune that was just read, and counts it as a change if they’re different. CountChanges and EducateWithEdits depend on every educated rune going through here or through replace.
+func (s *state) substitute(original, replacement rune) error {
+	if original == replacement {
+		return s.writeRune(replacement)
+	}
+	return s.replace(s.currentOffset()-int64(utf8.RuneLen(original)), string(replacement))
+}
+
+// replace writes replacement in place of everything read since start and counts it as a change.
+func (s *state) replace(start int64, replacement string) error {
+	s.changes++
+	if s.recordEdits {
+		s.edits = append(s.edits, Edit{OldStart: int(start), OldEnd: int(s.currentOffset()), NewText: replacement})
+	}
+	_, err := s.w.WriteString(replacement)
+	return err
+}
+
+func (s *state) WriteTo(w io.Writer) (n int64, err error) {
+	return s.w.WriteTo(w)
+}
+
+// A stateFunction specifies what to do to keep parsing the input given what’s come before.
+//
+// Conventions:
 //
 // Here’s the situation for the insides of stateFunctions that start with “at” (like “atHyphen” or “atYAMLFrontMatter”):
 //
@@ -292,6 +945,22 @@ type callback func(s *state) error
 func initial(s *state) error {
 	var p rune
 	var err error
+
+	// A fragment of a longer document can start in the middle of a quotation.
+	switch s.opts.InitialQuoteState {
+	case InsideDoubleQuotes:
+		err = inDoubleQuotes(s)
+	case InsideSingleQuotes:
+		err = inSingleQuotes(s)
+	default:
+		if s.opts.HeadingQuoteStyle != HeadingQuotesLikeBody {
+			err = atTitle(s)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
 	for err == nil {
 		p, err = s.peekRune()
 		if err != nil {
@@ -308,7 +977,7 @@ func initial(s *state) error {
 	return err
 }
 
-// atBackslash reads an assumed-to-exist \ and writes both it and the rune after it without further processing or examination.
+// atBackslash reads an assumed-to-exist \ and writes both it and the rune after it without further processing or examination. With Options.StripMarkdownEscapes, the backslash is dropped if the rune after it is one Markdown lets you escape.
 //
 // When atBackslash returns, readRune will return the rune after the rune after the backslash.
 func atBackslash(s *state) error {
@@ -317,6 +986,13 @@ func atBackslash(s *state) error {
 		return fmt.Errorf("expected read rune to be \\ in atBackslash. got: «%s» (%U)", string(r), r)
 	}
 
+	if s.opts.StripMarkdownEscapes && !s.opts.Typst {
+		if p, err := s.peekRune(); err == nil && isASCIIPunctuation(p) {
+			s.mustReadRune()
+			return s.replace(s.currentOffset()-2, string(p))
+		}
+	}
+
 	s.writeRune(r)
 
 	r, err := s.readRune()
@@ -329,21 +1005,100 @@ func atBackslash(s *state) error {
 	return err
 }
 
-// atDoubleQuote reads an assumed-to-exist " or “. It then writes a “ and hands processing off to inDoubleQuotes.
+// atDoubleQuote reads an assumed-to-exist " or Options.OpenDouble. It then writes an opening double quote and hands processing off to inDoubleQuotes.
 func atDoubleQuote(s *state) error {
 	r := s.mustReadRune()
-	if !(r == '"' || r == '“') {
-		return fmt.Errorf("expected read rune to be \" or “ in atDoubleQuote. got: «%s» (%U)", string(r), r)
+	if !(r == '"' || r == '“' || r == s.opts.OpenDouble) {
+		return fmt.Errorf("expected read rune to be \" or %s in atDoubleQuote. got: «%s» (%U)", string(s.opts.OpenDouble), string(r), r)
 	}
 
-	s.writeRune('“')
+	if r == '"' && s.inURLOrEmailishWord() {
+		return s.writeRune(r)
+	}
+
+	if s.straightQuoteIsPrime(r) {
+		return s.substitute(r, DoublePrime)
+	}
+
+	s.writeOpenDouble(r)
 	return inDoubleQuotes(s)
 }
 
-// inDoubleQuotes reads and writes runes inside double quotes, looking for some sort of closing double quote (either " or ”).
+// writeOpenDouble writes OpenDouble in place of r, which was just read, along with GuillemetSpace if there is one. Any spaces after r get replaced, too.
+func (s *state) writeOpenDouble(r rune) error {
+	if s.opts.GuillemetSpace == 0 {
+		return s.substitute(r, s.opts.OpenDouble)
+	}
+
+	start := s.currentOffset() - int64(utf8.RuneLen(r))
+	for p, err := s.peekRune(); err == nil && isGuillemetSpace(p); p, err = s.peekRune() {
+		s.mustReadRune()
+	}
+	return s.replaceIfDifferent(start, string(s.opts.OpenDouble)+string(s.opts.GuillemetSpace))
+}
+
+// writeCloseDouble writes CloseDouble in place of r, which was just read, with GuillemetSpace before it if there is one.
+func (s *state) writeCloseDouble(r rune) error {
+	if s.opts.GuillemetSpace == 0 {
+		return s.substitute(r, s.opts.CloseDouble)
+	}
+
+	return s.replaceIfDifferent(s.currentOffset()-int64(utf8.RuneLen(r)), string(s.opts.GuillemetSpace)+string(s.opts.CloseDouble))
+}
+
+// replaceIfDifferent is replace, except that it doesn’t count it as a change if replacement is what was there already.
+func (s *state) replaceIfDifferent(start int64, replacement string) error {
+	if string(s.src[start:s.currentOffset()]) == replacement {
+		_, err := s.w.WriteString(replacement)
+		return err
+	}
+	return s.replace(start, replacement)
+}
+
+// isGuillemetSpace returns true if r is a space that might be inside a French quotation already: a regular one, a no-break space, or a narrow no-break space.
+func isGuillemetSpace(r rune) bool {
+	return r == ' ' || r == '\u00A0' || r == '\u202F'
+}
+
+// spacesBeforeClosingDoubleQuote returns how many runes of spaces (see isGuillemetSpace) are just ahead, if what comes after them closes a double-quoted quotation. A " only counts if there isn’t a letter or digit right after it, since then it’s probably opening another one.
+func (s *state) spacesBeforeClosingDoubleQuote() (n int, ok bool) {
+	ahead := s.src[s.currentOffset():]
+	for {
+		r, size := utf8.DecodeRune(ahead)
+		if size == 0 {
+			return 0, false
+		}
+		ahead = ahead[size:]
+
+		if isGuillemetSpace(r) {
+			n++
+			continue
+		}
+
+		if !s.closesDoubleQuotes(r) {
+			return 0, false
+		}
+		if r == '"' {
+			if next, size := utf8.DecodeRune(ahead); size > 0 && (unicode.IsLetter(next) || unicode.IsDigit(next)) {
+				return 0, false
+			}
+		}
+		return n, true
+	}
+}
+
+// inDoubleQuotes reads and writes runes inside double quotes, looking for some sort of closing double quote (see closesDoubleQuotes).
 //
 // Ends and returns if a closing double quote is read or an error is encountered, although that may just be an io.EOF. The next rune to be read will be the one just after the closing double quote.
 func inDoubleQuotes(s *state) error {
+	return inDoubleQuotesClosedWith(s, false)
+}
+
+// inDoubleQuotesClosedWith is inDoubleQuotes, except that it closes the quotation with CloseSingle instead of CloseDouble if downgraded is set. That’s for SmartNesting, which turns a straight-double-quoted quotation inside another one into a single-quoted one.
+func inDoubleQuotesClosedWith(s *state, downgraded bool) error {
+	s.doubleQuotesOpen++
+	defer func() { s.doubleQuotesOpen-- }()
+
 	var p rune
 	var err error
 	for err == nil {
@@ -352,10 +1107,39 @@ func inDoubleQuotes(s *state) error {
 			break
 		}
 
-		if p == '"' || p == '”' {
+		if s.opts.GuillemetSpace != 0 && !downgraded && isGuillemetSpace(p) {
+			if n, ok := s.spacesBeforeClosingDoubleQuote(); ok {
+				start := s.currentOffset()
+				s.skip(n)
+				s.mustReadRune()
+				return s.replaceIfDifferent(start, string(s.opts.GuillemetSpace)+string(s.opts.CloseDouble))
+			}
+		}
+
+		if s.closesDoubleQuotes(p) {
+			r := s.mustReadRune()
+
+			if s.straightQuoteIsPrime(r) {
+				s.substitute(r, DoublePrime)
+				continue
+			}
+
+			if r == '"' && s.opts.SmartNesting && s.straightDoubleQuoteOpensNested() {
+				if downgraded {
+					s.writeOpenDouble(r)
+				} else {
+					s.substitute(r, s.opts.OpenSingle)
+				}
+				err = inDoubleQuotesClosedWith(s, !downgraded)
+				continue
+			}
+
+			if downgraded {
+				return s.substitute(r, s.opts.CloseSingle)
+			}
+
 			// normally we immediately write the freshly-read previously-peeked-at rune, but we want a ” in the output whether the input had a "or ”, so we just drop the maybe-educated freshly-read previously-peeked-at quote-mark rune on the floor
-			_ = s.mustReadRune()
-			return s.writeRune('”')
+			return s.writeCloseDouble(r)
 		} else if f, ok := s.whatDo[p]; ok {
 			err = f(s)
 		} else {
@@ -366,35 +1150,117 @@ func inDoubleQuotes(s *state) error {
 	return err
 }
 
-// atSingleQuote reads an assumed-to-exist ' or ‘ rune. It then writes a ‘ or ’ depending on whether the previous rune was a letter or not, as a ' right after a letter is probably being used as an apostrophe.
+// straightDoubleQuoteOpensNested returns true if the " just read looks like it opens a quotation instead of closing one: it comes after a space or an opening bracket and comes before something that isn’t a space, like the second " in «"She said "hi" to me"».
+func (s *state) straightDoubleQuoteOpensNested() bool {
+	if !s.atStartOfLine() && !s.previousRuneMatches(func(o rune) bool { return unicode.IsSpace(o) || isOpeningPunctuation(o) }) {
+		return false
+	}
+
+	p, err := s.peekRune()
+	return err == nil && !unicode.IsSpace(p)
+}
+
+// atSingleQuote reads an assumed-to-exist ' or ‘ rune. It then writes an opening single quote or an apostrophe depending on whether the previous rune was a letter or not, as a ' right after a letter is probably being used as an apostrophe.
 //
-// TODO(adiabatic): Doesn’t do the right thing for cases like <a>Mark Twain</a>'s autobiography.
+// A ' right after an HTML end tag that comes right after a letter, like the one in «<a>Mark Twain</a>'s autobiography», is an apostrophe, too.
 // BUG(adiabatic): This function will go to the inSingleQuotes state if the rune was ‘ and was preceded by a letter. Could be bad for Arabic in romanization, Hawaiian, and Maori (among others).
 func atSingleQuote(s *state) error {
 	r := s.mustReadRune()
-	if !(r == '\'' || r == '‘') {
+	if !(r == '\'' || r == '‘' || r == s.opts.OpenSingle) {
 		return fmt.Errorf("expecting a single quote, either curly or straight. got: «%s» (%U)", string(r), r)
 	}
 
-	if s.previousRuneMatches(unicode.IsLetter) {
-		return s.writeRune('’')
+	if r == '\'' && s.inURLOrEmailishWord() {
+		return s.writeRune(r)
+	}
+
+	if r == '\'' && s.opts.CodeLikeWords && s.inCodeLikeWord() {
+		return s.writeRune(r)
+	}
+
+	if s.straightQuoteIsPrime(r) {
+		return s.substitute(r, Prime)
 	}
 
-	if r == '\'' && s.previousRuneMatchesAny('>', ')') {
-		log.Printf("Found the string «%s'»; cannot tell whether this is a quote mark or an apostrophe. Leaving unchanged. Manually inspect subsequent quote marks.", string(s.mustPreviousRune()))
-		return s.writeRune('\'')
+	if r == '\'' && s.letterBeforeEndTag() {
+		return s.substitute(r, s.opts.Apostrophe)
 	}
 
-	s.writeRune('‘')
+	if !s.previousRuneMatches(unicode.IsLetter) {
+		if elision, ok := s.peekingAtElision(); ok && r == '\'' {
+			return s.writeElision(elision)
+		}
+
+		if r == '\'' && s.peekingAtElidedYear() {
+			return s.substitute(r, s.opts.Apostrophe)
+		}
+
+		if r == '\'' && s.afterClosingPunctuation() {
+			s.logf(LogAmbiguousQuote, s.currentOffset()-1, "Found the string «%s'»; cannot tell whether this is a quote mark or an apostrophe. Leaving unchanged. Manually inspect subsequent quote marks.", string(s.mustPreviousRune()))
+			return s.writeRune('\'')
+		}
+	}
+
+	switch s.opts.ResolveSingleQuote(s.quoteContext(r)) {
+	case QuoteApostrophe:
+		return s.substitute(r, s.opts.Apostrophe)
+	case QuoteClosing:
+		return s.substitute(r, s.opts.CloseSingle)
+	}
+
+	s.substitute(r, s.opts.OpenSingle)
 	return inSingleQuotes(s)
 }
 
-// inSingleQuotes reads and writes runes inside single quotes, looking for some sort of closing single quote (either ' or ’).
+// usesQuoteMark returns true if r is one of the four quote marks o writes.
+func (o Options) usesQuoteMark(r rune) bool {
+	return r == o.OpenDouble || r == o.CloseDouble || r == o.OpenSingle || r == o.CloseSingle
+}
+
+// closesDoubleQuotes returns true if p can close a double-quoted quotation: a ", CloseDouble, or a ” that CloseDouble doesn’t mean something else.
+func (s *state) closesDoubleQuotes(p rune) bool {
+	return p == '"' || p == s.opts.CloseDouble || (p == '”' && !s.opts.usesQuoteMark('”'))
+}
+
+// closesSingleQuotes returns true if p can close a single-quoted quotation (or be an apostrophe in one): a ', CloseSingle, or a ’ that CloseSingle doesn’t mean something else.
+func (s *state) closesSingleQuotes(p rune) bool {
+	return p == '\'' || p == s.opts.CloseSingle || (p == '’' && !s.opts.usesQuoteMark('’'))
+}
+
+// quoteContext describes the surroundings of quote, which was just read, for ResolveSingleQuote.
 //
-// Ends and returns if a closing single quote is read or an error is encountered, although that may just be an io.EOF. The next rune to be read will be the one just after the closing single quote.
+// Already-curly quote marks are described as ‘ and ’ no matter what the Options say they look like, so ResolveSingleQuote doesn’t have to know about every language’s.
+func (s *state) quoteContext(quote rune) QuoteContext {
+	if quote != '\'' {
+		switch quote {
+		case s.opts.OpenSingle:
+			quote = '‘'
+		case s.opts.CloseSingle:
+			quote = '’'
+		}
+	}
+
+	ctx := QuoteContext{
+		Quote:          quote,
+		InSingleQuotes: s.singleQuotesOpen > 0,
+		InDoubleQuotes: s.doubleQuotesOpen > 0,
+	}
+	if o, err := s.previousRune(); err == nil {
+		ctx.Previous = o
+	}
+	if p, err := s.peekRune(); err == nil {
+		ctx.Next = p
+	}
+	return ctx
+}
+
+// inSingleQuotes reads and writes runes inside single quotes, looking for some sort of closing single quote (see closesSingleQuotes).
 //
-// BUG(adiabatic): will mistakenly identify «don't» as a closing single quote
+// Ends and returns if a closing single quote is read or an error is encountered, although that may just be an io.EOF. The next rune to be read will be the one just after the closing single quote.
 func inSingleQuotes(s *state) error {
+	s.singleQuotesOpen++
+	defer func() { s.singleQuotesOpen-- }()
+
 	var p rune
 	var err error
 	for err == nil {
@@ -403,17 +1269,56 @@ func inSingleQuotes(s *state) error {
 			break
 		}
 
-		if p == '\'' || p == '’' {
-			// deliberately drop it on the floor (see comment in inDoubleQuotes)
-			_ = s.mustReadRune()
+		if s.closesSingleQuotes(p) {
+			r := s.mustReadRune()
+
+			if r == '\'' && s.inURLOrEmailishWord() {
+				s.writeRune(r)
+				continue
+			}
+
+			if r == '\'' && s.opts.CodeLikeWords && s.inCodeLikeWord() {
+				s.writeRune(r)
+				continue
+			}
+
+			if s.straightQuoteIsPrime(r) {
+				s.substitute(r, Prime)
+				continue
+			}
+
+			if elision, ok := s.peekingAtElision(); ok && r == '\'' && !s.previousRuneMatches(unicode.IsLetter) {
+				err = s.writeElision(elision)
+				continue
+			}
+
+			if r == '\'' && !s.previousRuneMatches(unicode.IsLetter) && s.peekingAtElidedYear() {
+				err = s.substitute(r, s.opts.Apostrophe)
+				continue
+			}
+
+			if p, err := s.peekRune(); r == '\'' && err == nil && unicode.IsLetter(p) && s.letterBeforeEndTag() {
+				err = s.substitute(r, s.opts.Apostrophe)
+				continue
+			}
+
+			if r == '\'' && s.atPluralPossessive() {
+				err = s.substitute(r, s.opts.Apostrophe)
+				continue
+			}
+
+			// otherwise, deliberately drop it on the floor (see comment in inDoubleQuotes)
 
-			if needle, ok := s.previousRunesMatchAny("can", "you", "don"); ok {
-				// this was probably an apostrophe in a contraction
-				log.Printf("The string «%s» was found right before an apostrophe inside of a single-quote quote. The apostrophe was assumed to be part of a contraction. Double-check the output to verify this was the case.", needle)
-				s.writeRune('’')
+			switch s.opts.ResolveSingleQuote(s.quoteContext(r)) {
+			case QuoteApostrophe:
+				s.substitute(r, s.opts.Apostrophe)
+				continue
+			case QuoteOpening:
+				s.substitute(r, s.opts.OpenSingle)
+				err = inSingleQuotes(s)
 				continue
 			}
-			return s.writeRune('’')
+			return s.substitute(r, s.opts.CloseSingle)
 
 		} else if f, ok := s.whatDo[p]; ok {
 			err = f(s)
@@ -426,6 +1331,8 @@ func inSingleQuotes(s *state) error {
 
 // atHyphen reads an assumed-to-exist - and checks to see if it could be the start of YAML front matter or not.
 //
+// Front matter has to start with a --- all on its own line at the very top of the document, so «---word» isn’t front matter.
+//
 // When it returns, if the rune was just a hyphen, the next character to be read will be the character after the hyphen. However, if the hyphen was the first of a YAML front matter block, the next character to be read will be whatever inYAMLFrontMatter says it will be.
 func atHyphen(s *state) error {
 	r := s.mustReadRune()
@@ -433,136 +1340,527 @@ func atHyphen(s *state) error {
 		return fmt.Errorf("expecting a hyphen. got: «%s» (%U)", string(r), r)
 	}
 
-	if s.currentOffset() == 1 && s.PeekEquals("--") {
+	// Typst and LaTeX documents don’t have front matter, so a --- at the start of one is just hyphens.
+	if s.currentOffset() == s.start+1 && !s.opts.Typst && !s.opts.LaTeX && s.skips(ContextYAML) && (s.PeekEquals("--\n") || s.PeekEquals("--\r\n") || (s.PeekEquals("--") && s.r.Len() == 2)) {
 		s.writeRune(r)
 		return inYAMLFrontMatter(s)
 	}
 
-	return s.writeRune(r)
-}
+	if s.opts.Dashes && s.hyphensAreDash(3) {
+		s.mustReadRune()
+		s.mustReadRune()
+		return s.replace(s.currentOffset()-3, string(EmDash))
+	}
 
-// inYAMLFrontMatter just reads and writes until it gets past a --- all on its own line.
-//
-// When inYAMLFrontMatter returns, the next rune to be read will be the first rune on the line after the closing ---.
-func inYAMLFrontMatter(s *state) error {
-	return s.AdvanceThrough("\n---\n") // Just don’t do anything
+	if s.opts.Dashes && s.hyphensAreDash(2) {
+		s.mustReadRune()
+		return s.replace(s.currentOffset()-2, string(EnDash))
+	}
+
+	if s.opts.NumberRangeDashes && s.hyphenIsInNumberRange() {
+		return s.substitute(r, EnDash)
+	}
+
+	return s.writeRune(r)
 }
 
-// atBacktick reads an assumed-to-exist `. It then peeks ahead and behind to figure out whether this is the start of a single-backtick code span or a triple-backtick code block.
-func atBacktick(s *state) error {
+// atPeriod reads an assumed-to-exist period. If it’s the first of exactly three, it writes an ellipsis instead of all of them.
+func atPeriod(s *state) error {
 	r := s.mustReadRune()
-	if r != '`' {
-		return fmt.Errorf("expecting a backtick. got: «%s» (%U)", string(r), r)
+	if r != '.' {
+		return fmt.Errorf("expecting a period. got: «%s» (%U)", string(r), r)
 	}
 
-	if s.PeekEquals("``") && s.previousRuneMatchesAny('\n') {
-		s.writeRune(r)
-		return inTripleBacktickCodeBlock(s)
+	if !s.PeekEquals("..") || s.PeekEquals("...") || s.previousRuneMatchesAny('.') || s.inURLOrEmailishWord() {
+		return s.writeRune(r)
 	}
 
-	s.writeRune(r)
-	return inSingleBacktickCodeSpan(s)
+	s.mustReadRune()
+	s.mustReadRune()
+	return s.replace(s.currentOffset()-3, string(Ellipsis))
 }
 
-// inSingleBacktickCodeSpan reads and writes runes inside a single-backtick code span. When it returns, the next rune to be read will be the one after the closing backtick.
-func inSingleBacktickCodeSpan(s *state) error {
-	return inSpanEndingWithSingleUnescapedRune(s, '`')
-}
+// hyphensAreDash returns true if the hyphen just read starts a run of exactly n hyphens that’s standing in for a dash, like the ones in «this -- that», «1914--1918», and «one---two». It has to have either spaces or letters and digits on both sides, and if it’s spaces, it can’t be the first thing on the line.
+//
+// Anything else is left alone, since it’s probably code that wandered out of its backticks: «--verbose» is a command-line flag, «-->» is an arrow or the end of an HTML comment, and «foo --» could be either. A --- on a line of its own is a horizontal rule or a setext heading’s underline, and the ones in «| --- | --- |» are a table’s delimiter row.
+func (s *state) hyphensAreDash(n int) bool {
+	if !s.PeekEquals(strings.Repeat("-", n-1)) || s.PeekEquals(strings.Repeat("-", n)) || s.previousRuneMatchesAny('-') {
+		return false
+	}
 
-// inSpanEndingWithSingleUnescapedRune reads and writes runes until it gets to a sentinel character not preceded by a backslash. When it returns, the next rune to be read will be the one after the sentinel value.
-func inSpanEndingWithSingleUnescapedRune(s *state, sentinel rune) error {
-	for {
-		r, err := s.readRune()
-		if err != nil {
-			return err
-		}
+	next, err := s.peekRuneAt(int64(n - 1))
+	if err != nil {
+		return false
+	}
 
-		previousRune := s.mustPreviousRune()
+	isWordy := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	switch {
+	case s.previousRuneMatchesAny(' ') && next == ' ' && !s.onlyWhitespaceSoFarOnLine():
+	case s.previousRuneMatches(isWordy) && isWordy(next):
+	default:
+		return false
+	}
 
-		s.writeRune(r) // after this call, r would be returned by s.previousRune()
+	return !s.inURLOrEmailishWord() && !s.onTableDelimiterRow()
+}
 
-		if r == sentinel && previousRune != '\\' {
-			break
-		}
-	}
+// onTableDelimiterRow returns true if the line the hyphen just read is on has nothing but pipes, colons, hyphens, and whitespace on it, like the second line of a GitHub-flavored Markdown table.
+func (s *state) onTableDelimiterRow() bool {
+	before := s.lineBefore(s.currentOffset())
 
-	if v := s.mustPreviousRune(); v != sentinel {
-		return fmt.Errorf("postcondition failed: expected the immediately previous rune to be a %s. got: «%s» (%U)", string(sentinel), string(v), v)
+	after := s.src[s.currentOffset():]
+	if i := bytes.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
 	}
 
-	return nil
-}
+	if !bytes.ContainsRune(before, '|') && !bytes.ContainsRune(after, '|') {
+		return false
+	}
 
-// inTripleBacktickCodeBlock just reads and writes until it gets past a ``` all on its own line.
-//
-// When inTripleBacktickCodeBlock returns, the next rune to be read will be the first rune on the line after the closing ```.
-func inTripleBacktickCodeBlock(s *state) error {
-	return s.AdvanceThrough("\n```\n") // Just don’t do anything here, either
+	notDelimiterRow := func(r rune) bool { return !strings.ContainsRune("|:- \t\r", r) }
+	return bytes.IndexFunc(before, notDelimiterRow) < 0 && bytes.IndexFunc(after, notDelimiterRow) < 0
 }
 
-// atLessThan reads an assumed-to-exist <. It then peeks ahead to figure out whether the < is a mere less-than sign or the start of an HTML tag.
+// hyphenIsInNumberRange returns true if the hyphen just read is between two plain numbers and is the only hyphen there, like the one in «10-20».
 //
-// When atLessThan returns, readRune will return the rune right after the < (or an error).
-func atLessThan(s *state) error {
-	r := s.mustReadRune()
-	if r != '<' {
-		return fmt.Errorf("expecting a less-than symbol (<). got: «%s» (%U)", string(r), r)
+// Three digits, a hyphen, and four digits is a phone number, not a range.
+func (s *state) hyphenIsInNumberRange() bool {
+	bs := s.w.Bytes()
+	i := len(bs)
+	for i > 0 && isASCIIDigit(rune(bs[i-1])) {
+		i--
 	}
-
-	s.writeRune(r)
-
-	p, err := s.peekRune()
-	if err != nil {
-		return err
+	left := bs[i:]
+	if len(left) == 0 {
+		return false
 	}
-
-	// https://html.spec.whatwg.org/multipage/syntax.html#syntax-tag-name notwithstanding, no elements are ever going to *start* with a *number*, right?
-	if unicode.IsLetter(p) {
-		return inHTMLStartTagName(s)
+	if o, size := utf8.DecodeLastRune(bs[:i]); size > 0 && (unicode.IsLetter(o) || strings.ContainsRune("-–/.,:", o)) {
+		return false
 	}
 
-	if p == '/' {
-		return inHTMLEndTagName(s)
+	ahead := s.src[s.currentOffset():]
+	j := 0
+	for j < len(ahead) && isASCIIDigit(rune(ahead[j])) {
+		j++
+	}
+	right := ahead[:j]
+	if len(right) == 0 {
+		return false
+	}
+	if p, size := utf8.DecodeRune(ahead[j:]); size > 0 {
+		if unicode.IsLetter(p) || strings.ContainsRune("-–/:", p) {
+			return false
+		}
+		if (p == '.' || p == ',') && j+1 < len(ahead) && isASCIIDigit(rune(ahead[j+1])) {
+			return false // a decimal or a thousands separator
+		}
 	}
 
-	return s.writeRune(s.mustReadRune())
+	return !(len(left) == 3 && len(right) == 4)
 }
 
-// inHTMLStartTagName reads and writes an HTML start tag.
+// inYAMLFrontMatter just reads and writes until it gets past a --- all on its own line.
 //
-// When it finishes, the current rune is either
-// the rune right after the tag’s closing >
-// or the first character of the first attribute’s name.
-func inHTMLStartTagName(s *state) error {
-	var p rune
-	var err error
+// That’s not as naïve as it looks. YAML says a --- at the start of a line always starts a new document, even in the middle of a block scalar or a multi-line quoted string, so a --- that’s part of a value has to be indented and won’t match. A --- with trailing spaces won’t match either, but then Jekyll and Hugo wouldn’t think it closed the front matter, so that’s fine.
+//
+// The closing --- can end with a \r\n instead of a \n, for documents with Windows line endings.
+//
+// When inYAMLFrontMatter returns, the next rune to be read will be the first rune on the line after the closing ---.
+func inYAMLFrontMatter(s *state) error {
+	ahead := s.src[s.currentOffset():]
+	lf, crlf := bytes.Index(ahead, []byte("\n---\n")), bytes.Index(ahead, []byte("\n---\r\n"))
+	if crlf >= 0 && (lf < 0 || crlf < lf) {
+		return s.AdvanceThrough("\n---\r\n")
+	}
+	return s.AdvanceThrough("\n---\n") // Just don’t do anything
+}
 
-	// Are we entering a code element? They’re special because we don’t curl quotes there.
-	codeElementsEnteredAtStart := s.codeElementsEntered
-	if s.PeekEquals("code") {
-		s.codeElementsEntered++
+// atSpace reads an assumed-to-exist space and writes a single space for it and any spaces right after it.
+//
+// Runs of spaces at the start of a line are indentation, and runs at the end of a line might be a Markdown hard line break, so those are written as-is. Other runs are only collapsed if CollapseSpaces is on; EducateAndLint uses atSpace just to find them.
+func atSpace(s *state) error {
+	r := s.mustReadRune()
+	if r != ' ' {
+		return fmt.Errorf("expecting a space. got: «%s» (%U)", string(r), r)
 	}
 
-	// Read and write the element name.
-	// When this is done, the last letter of the element name will be freshly written.
-	// The next rune will be either whitespace (maybe junk, maybe preceding an attribute) or >.
+	startsLine := s.atStartOfLine()
+	afterSentence := s.previousRuneMatchesAny('.', '?', '!')
+	offset := s.currentOffset() - 1
+	s.writeRune(r)
+
+	var n int64
 	for {
-		p, err = s.peekRune()
+		p, err := s.peekRuneAt(n)
 		if err != nil {
-			log.Println("Unexpected error peeking rune in inHTMLStartTagName")
-			return err
+			// the run goes all the way to EOF, so it’s trailing whitespace
+			return s.AdvanceBy(int(n))
 		}
-
-		if isASCIIWhitespace(p) || p == '>' {
-			// log.Printf("The first not-a-start-tag rune was «%s» (%U)", string(p), p)
-			break
+		if p != ' ' {
+			if startsLine || p == '\n' || p == '\r' {
+				return s.AdvanceBy(int(n))
+			}
+			if s.lint && afterSentence && n > 0 {
+				s.diagnose(offset, fmt.Sprintf("%d spaces after a sentence", n+1))
+			}
+			if !s.opts.CollapseSpaces {
+				return s.AdvanceBy(int(n))
+			}
+			start := s.currentOffset()
+			if err := s.skip(int(n)); err != nil {
+				return err
+			}
+			return s.replace(start, "")
 		}
+		n++
+	}
+}
 
-		s.writeRune(s.mustReadRune())
+// commonFractions maps the fractions that Options.Fractions looks for to their single-rune versions.
+var commonFractions = map[string]rune{
+	"1/2": '½',
+	"1/4": '¼',
+	"3/4": '¾',
+}
+
+// atDigit reads an assumed-to-exist digit. If the digit starts one of the commonFractions, and the fraction isn’t bounded by other digits or slashes (like in «11/2», «1/2/2020», or «docs/1/4/»), it writes the single-rune version of the fraction instead.
+//
+// When atDigit returns, the next rune to be read will be the one after the digit or after the fraction.
+func atDigit(s *state) error {
+	r := s.mustReadRune()
+	if !unicode.IsDigit(r) {
+		return fmt.Errorf("expecting a digit. got: «%s» (%U)", string(r), r)
 	}
 
-	if p = s.mustPeekRune(); !(p == '>' || isASCIIWhitespace(p)) {
-		log.Fatalf("postcondition failed. was expecting p to be either > or whitespace; was «%s» (%U)", string(p), p)
+	if s.previousRuneMatches(isDigitOrSlash) {
+		return s.writeRune(r)
+	}
+
+	for fraction, glyph := range commonFractions {
+		if rune(fraction[0]) != r || !s.PeekEquals(fraction[1:]) {
+			continue
+		}
+
+		if next, err := s.peekRuneAt(int64(len(fraction) - 1)); err == nil && isDigitOrSlash(next) {
+			continue
+		}
+
+		start := s.currentOffset() - 1
+		if err := s.skip(len(fraction) - 1); err != nil {
+			return err
+		}
+		return s.replace(start, string(glyph))
+	}
+
+	return s.writeRune(r)
+}
+
+// atTemplateTag returns a callback that checks whether opener is just ahead. If it is, the callback writes everything from there through the next closer without further processing. If it isn’t, the callback hands off to otherwise, or just reads and writes a rune if otherwise is nil.
+func atTemplateTag(opener, closer string, otherwise callback) callback {
+	return func(s *state) error {
+		if !s.PeekEquals(opener) {
+			if otherwise != nil {
+				return otherwise(s)
+			}
+			return s.writeRune(s.mustReadRune())
+		}
+
+		if err := s.AdvanceBy(utf8.RuneCountInString(opener)); err != nil {
+			return err
+		}
+
+		return s.AdvanceThrough(closer)
+	}
+}
+
+// atxHeading matches the start of a Markdown heading like «## Heading», up to three spaces of indentation and all.
+var atxHeading = regexp.MustCompile(`^ {0,3}#{1,6}(?:[ \t]|\n|$)`)
+
+// atHash reads an assumed-to-exist #. If it starts a Markdown heading, the whole heading is educated in Options.HeadingQuoteStyle.
+func atHash(s *state) error {
+	bs := s.w.Bytes()
+	line := bs[bytes.LastIndexByte(bs, '\n')+1:]
+	if len(bytes.TrimLeft(line, " ")) == 0 && atxHeading.Match(append(line[:len(line):len(line)], s.src[s.currentOffset():]...)) {
+		return s.educateLineAsHeading()
+	}
+
+	return s.writeRune(s.mustReadRune())
+}
+
+// setextUnderline matches the line of =s or -s under a setext heading.
+var setextUnderline = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*\r?$`)
+
+// atTitle educates the first line of the document as a heading if something says it’s a title: a setext underline under it, or a blank line after it with more of the document after that. A document that’s only one line long is just a short document, not a title with nothing under it. Front matter doesn’t count.
+func atTitle(s *state) error {
+	ahead := s.src[s.currentOffset():]
+	if bytes.HasPrefix(ahead, []byte("---")) {
+		return nil
+	}
+
+	line, rest, _ := bytes.Cut(ahead, []byte("\n"))
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	next, rest, _ := bytes.Cut(rest, []byte("\n"))
+	if setextUnderline.Match(next) || (len(bytes.TrimSpace(next)) == 0 && len(bytes.TrimSpace(rest)) > 0) {
+		return s.educateLineAsHeading()
+	}
+
+	return nil
+}
+
+// educateLineAsHeading educates the rest of the line (but not its newline) in Options.HeadingQuoteStyle.
+func (s *state) educateLineAsHeading() error {
+	line, _, _ := bytes.Cut(s.src[s.currentOffset():], []byte("\n"))
+	return s.educateSpan(len(line), headingOptions(s.opts))
+}
+
+// alertMarker matches the [!NOTE] (or [!WARNING], or Obsidian’s [!my-own-thing]) that starts a GitHub-style alert.
+var alertMarker = regexp.MustCompile(`^\[![A-Za-z][A-Za-z0-9_-]*\]`)
+
+// atOpenBracket copies the marker of a GitHub- or Obsidian-style alert, like the [!NOTE] in «> [!NOTE]», through untouched. The alert’s body is just blockquoted prose, so it gets educated like any other.
+//
+// Any other [ is just a [.
+func atOpenBracket(s *state) error {
+	if m := alertMarker.Find(s.src[s.currentOffset():]); m != nil && s.atStartOfBlockquote() {
+		return s.AdvanceBy(len(m)) // it’s all ASCII, so bytes are runes
+	}
+
+	return s.writeRune(s.mustReadRune())
+}
+
+// atStartOfBlockquote returns true if everything written so far on this line is blockquote >s and the spaces around them.
+func (s *state) atStartOfBlockquote() bool {
+	bs := s.w.Bytes()
+	line := bs[bytes.LastIndexByte(bs, '\n')+1:]
+	return bytes.ContainsRune(line, '>') && len(bytes.Trim(line, "> \t")) == 0
+}
+
+// atBacktick reads an assumed-to-exist `. It then peeks ahead and behind to figure out whether this is the start of a single-backtick code span or a triple-backtick code block.
+func atBacktick(s *state) error {
+	r := s.mustReadRune()
+	if r != '`' {
+		return fmt.Errorf("expecting a backtick. got: «%s» (%U)", string(r), r)
+	}
+
+	// A fence can start the document, too, and then there’s no newline before it.
+	if s.PeekEquals("``") && s.atStartOfLine() {
+		s.writeRune(r)
+		if !s.skips(ContextCodeBlock) {
+			// The fence itself is still a fence, not a bunch of code spans in a row.
+			return s.AdvanceUntilFalse(func(r rune) bool { return r == '`' })
+		}
+		return inTripleBacktickCodeBlock(s)
+	}
+
+	if s.opts.LegacyGraveQuotes {
+		s.substitute(r, s.opts.OpenSingle)
+		return inSingleQuotes(s)
+	}
+
+	s.writeRune(r)
+
+	if !s.skips(ContextInlineCode) {
+		return nil
+	}
+
+	// A code span can be opened with any number of backticks, like «``a`b``», and it’s closed by the next run of exactly as many.
+	ahead := s.src[s.currentOffset():]
+	if extra := len(ahead) - len(bytes.TrimLeft(ahead, "`")); extra > 0 {
+		if end := closingBacktickRun(ahead[extra:], extra+1); end >= 0 {
+			return s.AdvanceBy(utf8.RuneCount(ahead[:extra+end]))
+		}
+		// …and if it isn’t ever closed, it’s just backticks.
+		return s.AdvanceBy(extra)
+	}
+
+	// CommonMark says a backtick that never gets closed is just a backtick.
+	if !s.unescapedRuneAhead('`') {
+		return nil
+	}
+
+	return inSingleBacktickCodeSpan(s)
+}
+
+// closingBacktickRun returns how far into b the first run of exactly n backticks ends, or -1 if there isn’t one.
+func closingBacktickRun(b []byte, n int) int {
+	for i := 0; i < len(b); {
+		if b[i] != '`' {
+			i++
+			continue
+		}
+		run := len(b[i:]) - len(bytes.TrimLeft(b[i:], "`"))
+		if run == n {
+			return i + run
+		}
+		i += run
+	}
+	return -1
+}
+
+// inSingleBacktickCodeSpan reads and writes runes inside a single-backtick code span. When it returns, the next rune to be read will be the one after the closing backtick.
+func inSingleBacktickCodeSpan(s *state) error {
+	return inSpanEndingWithSingleUnescapedRune(s, '`')
+}
+
+// inSpanEndingWithSingleUnescapedRune reads and writes runes until it gets to a sentinel character not preceded by a backslash. When it returns, the next rune to be read will be the one after the sentinel value.
+func inSpanEndingWithSingleUnescapedRune(s *state, sentinel rune) error {
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return err
+		}
+
+		previousRune := s.mustPreviousRune()
+
+		s.writeRune(r) // after this call, r would be returned by s.previousRune()
+
+		if r == sentinel && previousRune != '\\' {
+			break
+		}
+	}
+
+	if v := s.mustPreviousRune(); v != sentinel {
+		return fmt.Errorf("postcondition failed: expected the immediately previous rune to be a %s. got: «%s» (%U)", string(sentinel), string(v), v)
+	}
+
+	return nil
+}
+
+// inTripleBacktickCodeBlock just reads and writes until it gets past a ``` all on its own line. Like CommonMark says, the closing ``` can be indented by up to three spaces, and it has to be at least as long as the opening one, so a block opened with ```` can have ``` inside it.
+//
+// It’s called with the opening fence’s first backtick already written.
+//
+// When inTripleBacktickCodeBlock returns, the next rune to be read will be the first rune on the line after the closing ```.
+func inTripleBacktickCodeBlock(s *state) error {
+	fenceLength := 1 + len(s.src[s.currentOffset():]) - len(bytes.TrimLeft(s.src[s.currentOffset():], "`"))
+
+	// The rest of the opening fence’s line, info string and all
+	if err := s.AdvanceThrough("\n"); err != nil {
+		return err
+	}
+
+	for {
+		if n, ok := s.closingFenceAhead(fenceLength); ok {
+			return s.AdvanceBy(n)
+		}
+		if err := s.AdvanceThrough("\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// closingFenceAhead returns true if the line ahead is a closing fence of at least fenceLength backticks, along with how many runes long the line is, newline and all, for AdvanceBy. Only spaces and tabs can come between the backticks and the end of the line.
+func (s *state) closingFenceAhead(fenceLength int) (n int, ok bool) {
+	line := s.src[s.currentOffset():]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i+1]
+	}
+
+	rest := bytes.TrimLeft(line, " ")
+	if len(line)-len(rest) > 3 {
+		return 0, false
+	}
+
+	afterFence := bytes.TrimLeft(rest, "`")
+	if len(rest)-len(afterFence) < fenceLength || len(bytes.TrimRight(afterFence, " \t\r\n")) > 0 {
+		return 0, false
+	}
+
+	return utf8.RuneCount(line), true
+}
+
+// autolink matches the rest of a CommonMark autolink after its <, like «https://example.com/it's>» or «o'brien@example.com>». Autolinks can’t have spaces, <, or > in them, so a URL with a > in it ends at the >, and the rest is prose again.
+//
+// https://spec.commonmark.org/0.31.2/#autolinks
+var autolink = regexp.MustCompile(`^(?:[A-Za-z][A-Za-z0-9+.-]{1,31}:[^<>\x00-\x20\x7f]*|[A-Za-z0-9.!#$%&'*+/=?^_\x60{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*)>`)
+
+// uriScheme matches the scheme at the start of what’s after a <, if it looks like it’s trying to be an autolink. It wants the // so namespaced tags like «<svg:rect x="1">» are still tags.
+var uriScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]{1,31}://`)
+
+// atLessThan reads an assumed-to-exist <. It then peeks ahead to figure out whether the < is a mere less-than sign or the start of an HTML tag.
+//
+// When atLessThan returns, readRune will return the rune right after the < (or an error).
+func atLessThan(s *state) error {
+	r := s.mustReadRune()
+	if r != '<' {
+		return fmt.Errorf("expecting a less-than symbol (<). got: «%s» (%U)", string(r), r)
+	}
+
+	s.writeRune(r)
+
+	if m := autolink.Find(s.src[s.currentOffset():]); m != nil {
+		return s.AdvanceBy(utf8.RuneCount(m))
+	}
+
+	// Something like «<https://example.com/?q="a b">» isn’t an autolink, what with the space, and it isn’t a tag either. It’s still almost certainly a URL, though, so it’s copied through the > as long as that’s on the same line. If it isn’t, the < is just a <.
+	if ahead := s.src[s.currentOffset():]; uriScheme.Match(ahead) {
+		line, _, _ := bytes.Cut(ahead, []byte("\n"))
+		if end := bytes.IndexByte(line, '>'); end >= 0 {
+			return s.AdvanceBy(utf8.RuneCount(line[:end+1]))
+		}
+		return nil
+	}
+
+	p, err := s.peekRune()
+	if err != nil {
+		return err
+	}
+
+	// https://html.spec.whatwg.org/multipage/syntax.html#syntax-tag-name notwithstanding, no elements are ever going to *start* with a *number*, right?
+	if unicode.IsLetter(p) {
+		return inHTMLStartTagName(s)
+	}
+
+	if p == '/' {
+		return inHTMLEndTagName(s)
+	}
+
+	return s.writeRune(s.mustReadRune())
+}
+
+// inHTMLStartTagName reads and writes an HTML start tag.
+//
+// When it finishes, the current rune is either
+// the rune right after the tag’s closing >
+// or the first character of the first attribute’s name.
+func inHTMLStartTagName(s *state) error {
+	var p rune
+	var err error
+
+	// Are we entering a code element (or some other raw-text element)? They’re special because we don’t curl quotes there.
+	codeElementsEnteredAtStart := s.codeElementsEntered
+	enteringSVG := s.skips(ContextScript) && s.peekTagNameFold("svg")
+	for _, name := range s.opts.RawTextElements {
+		if s.skips(ContextScript) && s.peekTagNameFold(name) {
+			s.codeElementsEntered++
+			s.codeElement = name
+			break
+		}
+	}
+
+	// Read and write the element name.
+	// When this is done, the last letter of the element name will be freshly written.
+	// The next rune will be either whitespace (maybe junk, maybe preceding an attribute) or >.
+	for {
+		p, err = s.peekRune()
+		if err != nil {
+			s.logf(LogUnexpected, s.currentOffset(), "Unexpected error peeking rune in inHTMLStartTagName: %v", err)
+			return err
+		}
+
+		if isASCIIWhitespace(p) || p == '>' {
+			// log.Printf("The first not-a-start-tag rune was «%s» (%U)", string(p), p)
+			break
+		}
+
+		s.writeRune(s.mustReadRune())
+	}
+
+	if p = s.mustPeekRune(); !(p == '>' || isASCIIWhitespace(p)) {
+		s.logf(LogPostcondition, s.currentOffset(), "Postcondition failed in inHTMLStartTagName: was expecting p to be either > or whitespace; was «%s» (%U)", string(p), p)
+		return fmt.Errorf("postcondition failed in inHTMLStartTagName. was expecting p to be either > or whitespace; was «%s» (%U)", string(p), p)
 	}
 
 	// Now we need to advance past any whitespace so s.peekRune() gives us either an attribute name or >.
@@ -590,17 +1888,23 @@ func inHTMLStartTagName(s *state) error {
 		} // no special handling for non-code HTML attributes
 	}
 
+	if enteringSVG && err == nil && !s.previousRuneMatchesAny('/') {
+		return inSVGElement(s)
+	}
+
 	return err
 }
 
-// handleHTMLAttributes churns through HTML attributes. When it ends, s.peekRune() will return >.
+// handleHTMLAttributes churns through HTML attributes. When it ends, s.peekRune() will return >, unless the input ran out first, in which case it returns io.EOF and what there was of the tag has been written as-is.
 func handleHTMLAttributes(s *state) error {
 	var p rune
 	var err error
 
 	for err == nil {
-
-		p = s.mustPeekRune()
+		p, err = s.peekRune()
+		if err != nil {
+			return err
+		}
 
 		if isASCIIWhitespace(p) {
 			err = s.AdvanceUntilFalse(isASCIIWhitespace)
@@ -618,15 +1922,33 @@ func handleHTMLAttributes(s *state) error {
 		}
 
 		// Churn through any whitespace until we get to what should be either a > or =.
-		if isASCIIWhitespace(s.mustPeekRune()) {
+		if p, err = s.peekRune(); err != nil {
+			return err
+		}
+		if isASCIIWhitespace(p) {
 			err = s.AdvanceUntilFalse(isASCIIWhitespace)
 			if err != nil {
 				return err
 			}
 		}
 
-		if p = s.mustPeekRune(); !(p == '>' || p == '=') {
-			log.Fatalf("postcondition failed. p was expected to be either > or =, but was «%s» instead", string(p))
+		// An attribute with no value, like «hidden» in «<p hidden data-x="1">», is followed right away by the next attribute’s name.
+		if p, err = s.peekRune(); err != nil {
+			return err
+		}
+		if isLegalHTMLAttributeNameRune(p) {
+			continue
+		}
+
+		// The / of a self-closing tag like «<img src="x" />» doesn’t mean anything in HTML, so just pass it through.
+		if p == '/' {
+			s.writeRune(s.mustReadRune())
+			continue
+		}
+
+		if !(p == '>' || p == '=') {
+			s.logf(LogPostcondition, s.currentOffset(), "Postcondition failed in handleHTMLAttributes: p was expected to be either > or =, but was «%s» (%U) instead", string(p), p)
+			return fmt.Errorf("postcondition failed in handleHTMLAttributes. p was expected to be either > or =, but was «%s» (%U) instead", string(p), p)
 		}
 
 		if p == '>' {
@@ -658,7 +1980,11 @@ func handleHTMLAttributes(s *state) error {
 			return err
 		}
 
+		valueStart := s.currentOffset()
 		switch {
+		case (p == '"' || p == '\'') && !s.skips(ContextHTMLAttr):
+			s.writeRune(s.mustReadRune())
+			err = s.educateAttributeValue(byte(p))
 		case p == '"':
 			s.writeRune(s.mustReadRune())
 			err = inDoubleQuotedAttributeValue(s)
@@ -670,7 +1996,75 @@ func handleHTMLAttributes(s *state) error {
 		default:
 			err = fmt.Errorf("got some weird rune that’s starting an HTML attribute value: «%s» (%U)", string(p), p)
 		}
+
+		// Everything after an unclosed quote has been copied through as part of the value by now. That’s as good as it gets when being lenient, but otherwise, the rest of the document was silently left alone.
+		if err == io.EOF && (p == '"' || p == '\'') && !s.opts.Lenient {
+			line := bytes.Count(s.src[:valueStart], []byte("\n")) + 1
+			return fmt.Errorf("the attribute value starting with the %s on line %d is never closed", string(p), line)
+		}
+	}
+	return err
+}
+
+// educateAttributeValue educates a quoted attribute value as if it were a document all its own, for when Options.SkipContexts doesn’t have ContextHTMLAttr in it. It’s called with the opening quote mark already written, and it writes the closing one, but leaves both straight, since they’re HTML, not prose.
+//
+// A value that never gets closed is copied as-is, like it would be otherwise.
+func (s *state) educateAttributeValue(delimiter byte) error {
+	start := s.currentOffset()
+	end := bytes.IndexByte(s.src[start:], delimiter)
+	if end < 0 {
+		return inSpanEndingWithSingleUnescapedRune(s, rune(delimiter))
+	}
+
+	if err := s.educateSpan(end, s.opts); err != nil {
+		return err
+	}
+	return s.writeRune(s.mustReadRune())
+}
+
+// educateSpan educates the next n bytes with opts as if they were a document all their own and writes the result, so that whatever comes after them (like the end of an attribute value, or an end tag) can’t get swallowed up by quotes that are never closed. Changes and edits are counted as if they were made here.
+//
+// A --- at the start of the span is just hyphens, though, not front matter, and the span doesn’t start in the middle of a quotation (or get its own headings) just because the document does.
+func (s *state) educateSpan(n int, opts Options) error {
+	start := s.currentOffset()
+
+	skipContexts := opts.SkipContexts
+	opts.InitialQuoteState = OutsideQuotes
+	opts.HeadingQuoteStyle = HeadingQuotesLikeBody
+	opts.SkipContexts = nil
+	for _, c := range skipContexts {
+		if c != ContextYAML {
+			opts.SkipContexts = append(opts.SkipContexts, c)
+		}
+	}
+
+	if parentLog := opts.Log; parentLog != nil {
+		opts.Log = func(entry LogEntry) {
+			entry.Offset += int(start)
+			entry.Line, entry.Column = s.position(int64(entry.Offset))
+			parentLog(entry)
+		}
+	}
+
+	span, err := newState(bytes.NewReader(s.src[start:start+int64(n)]), opts)
+	if err != nil {
+		return err
+	}
+	span.recordEdits = s.recordEdits
+	span.countOnly = s.countOnly
+	if err := initial(&span); err != nil && err != io.EOF {
+		return err
+	}
+
+	s.changes += span.changes
+	for _, edit := range span.edits {
+		edit.OldStart += int(start)
+		edit.OldEnd += int(start)
+		s.edits = append(s.edits, edit)
 	}
+	s.w.Write(span.w.Bytes())
+
+	_, err = s.r.Seek(int64(n), io.SeekCurrent)
 	return err
 }
 
@@ -704,35 +2098,64 @@ func inUnquotedAttributeValue(s *state) error {
 	return nil
 }
 
+// inHTMLEndTagName reads and writes an HTML end tag, starting with its /. Degenerate ones like </> and </ > get copied through as-is.
+//
+// Raw-text elements’ end tags are normally eaten by inCodeElement, so the only ones that make it here are strays, and those mustn’t take codeElementsEntered below zero.
 func inHTMLEndTagName(s *state) error {
-	if s.PeekEquals("code") {
-		s.codeElementsEntered--
+	if err := s.writeRune(s.mustReadRune()); err != nil {
+		return err
+	}
+
+	for _, name := range s.opts.RawTextElements {
+		if s.peekTagNameFold(name) {
+			if s.codeElementsEntered > 0 {
+				s.codeElementsEntered--
+			}
+			break
+		}
 	}
 
 	return s.AdvanceThrough(">")
 }
 
+// inCodeElement copies everything up through the end tag of s.codeElement without curling anything.
+//
+// If there isn’t an end tag, that’s an error, unless s.opts.Lenient is set, in which case the start tag is written out and everything after it is taken to be prose.
 func inCodeElement(s *state) error {
-	err := s.AdvanceThrough("</code")
-	if err != nil {
-		return err
+	ahead := s.src[s.currentOffset():]
+	end := indexTagFold(ahead, "</"+s.codeElement)
+	if end < 0 {
+		if s.opts.Lenient {
+			s.codeElementsEntered--
+			return s.writeRune(s.mustReadRune())
+		}
+		line := bytes.Count(s.src[:s.currentOffset()], []byte("\n")) + 1
+		return fmt.Errorf("the <%s> start tag on line %d is never closed with a </%s> end tag", s.codeElement, line, s.codeElement)
 	}
 
-	err = s.AdvanceUntilTrue(isASCIIWhitespace)
-	if err != nil {
+	// AdvanceBy counts runes, not bytes, and there might be more than a few non-ASCII ones in there.
+	if err := s.AdvanceBy(utf8.RuneCount(ahead[:end])); err != nil {
 		return err
 	}
 
-	return s.writeRune(s.mustReadRune())
+	s.codeElementsEntered--
+	return s.AdvanceThrough(">")
 }
 
 // Not yet added: in/at functions for: <, HTML element names, HTML element attributes, HTML element attribute values, old-school four-indent preformatted-code blocks
 
 // Educate curls quotes from in and writes them to out.
 //
+// It’s safe to call from multiple goroutines at once, so long as they don’t share readers or writers: everything it keeps track of lives in a fresh state, and the package-level tables it consults are never written to after initialization.
+//
 // Blindly copies the interface of io.Copy without deeply considering why it has the return values it has.
 func Educate(out io.Writer, in *bytes.Reader) (written int64, err error) {
-	s, err := newState(in)
+	return EducateWithOptions(out, in, DefaultOptions())
+}
+
+// EducateWithOptions is like Educate, but writes whatever opts says to write.
+func EducateWithOptions(out io.Writer, in *bytes.Reader, opts Options) (written int64, err error) {
+	s, err := newState(in, opts)
 	if err != nil {
 		return 0, err
 	}
@@ -743,83 +2166,562 @@ func Educate(out io.Writer, in *bytes.Reader) (written int64, err error) {
 		return 0, err
 	}
 
-	return s.WriteTo(out)
+	if opts.WriteBOM {
+		n, err := io.WriteString(out, "\uFEFF")
+		if err != nil {
+			return int64(n), err
+		}
+		written = int64(n)
+	}
+
+	n, err := s.WriteTo(out)
+	return written + n, err
+}
+
+// EducateLine educates line as if it were a document all its own, using opts. It’s what -line uses.
+//
+// Nothing carries over from one line to the next: a quote left open at the end of a line stays open, a code fence only covers its own line, and front matter never gets recognized as front matter.
+func EducateLine(line string, opts Options) (string, error) {
+	return educateString(line, opts)
+}
+
+// educateString runs EducateWithOptions on a string. Everything that educates a piece of a file at a time (Fountain, PO, subtitles, -line) goes through here.
+func educateString(in string, opts Options) (string, error) {
+	var out strings.Builder
+	if _, err := EducateWithOptions(&out, bytes.NewReader([]byte(in)), opts); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// CountChanges returns how many quote marks (and whatever else DefaultOptions educates) in s would be changed by Educate. Zero means s is already educated.
+//
+// A byte-order mark at the start of s counts as one change, since Educate drops it, the same way EducateWithEdits reports it as an Edit.
+//
+// Text without any quote marks (or a byte-order mark) in it is never parsed at all, since there’s nothing to change, and the educated text is never put together, just counted. If Educate would fail partway through, CountChanges returns the changes up to that point along with the error.
+func CountChanges(s string) (int, error) {
+	if !strings.ContainsAny(s, "\"'“‘") && !strings.HasPrefix(s, "\uFEFF") {
+		return 0, nil
+	}
+
+	return CountChangesWithOptions(s, DefaultOptions())
+}
+
+// CountChangesWithOptions is like CountChanges, but counts what EducateWithOptions would change with opts. Since opts might educate dashes or ellipses too, it always parses s, quote marks or no quote marks.
+func CountChangesWithOptions(s string, opts Options) (int, error) {
+	st, err := newState(bytes.NewReader([]byte(s)), opts)
+	if err != nil {
+		return 0, err
+	}
+	st.countOnly = true
+	if st.start > 0 && !opts.WriteBOM {
+		// newState skipped the byte-order mark, and it won’t be written out
+		st.changes++
+	}
+
+	if err := initial(&st); err != nil && err != io.EOF {
+		return st.changes, err
+	}
+	return st.changes, nil
+}
+
+// EducateText curls quotes in s and then HTML-escapes the result so it can be dropped straight into a web page.
+//
+// Unlike Educate, EducateText assumes s is plain text, not Markdown or HTML. Backslashes, backticks, and hyphens get no special treatment, and every < and & is taken to be literal text.
+func EducateText(s string) string {
+	st, err := newState(bytes.NewReader([]byte(s)), DefaultOptions())
+	if err != nil {
+		panic(err) // newState only complains about nil readers
+	}
+
+	st.whatDo = map[rune]callback{
+		'"':  atDoubleQuote,
+		'“':  atDoubleQuote,
+		'\'': atSingleQuote,
+		'‘':  atSingleQuote,
+	}
+
+	// The quote-handling functions only fail when they’re called on the wrong rune, which the map above rules out, so the only thing that comes back here is io.EOF.
+	_ = initial(&st)
+
+	return html.EscapeString(st.w.String())
 }
 
 func main() {
-	var whence io.Reader = os.Stdin
-	var whither = os.Stdout
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	rewriteInPlace := flag.Bool("w", false, "write result to (source) file instead of stdout")
-	addExtraNewline := flag.Bool("n", false, "add an extra newline at the end")
-	showHelp := flag.Bool("h", false, "Show help")
+// hiddenFlags are left out of -h’s output. They’re for measuring quote-educator itself, not for everyday use.
+var hiddenFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+}
 
-	flag.Parse()
+// printVisibleDefaults is flags.PrintDefaults without the hiddenFlags.
+func printVisibleDefaults(flags *flag.FlagSet) {
+	visible := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	visible.SetOutput(flags.Output())
+	flags.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue // Var takes the current value as the default
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// printUsage prints a line about the subcommands and then the educate subcommand’s visible flags.
+func printUsage(flags *flag.FlagSet) {
+	fmt.Fprintln(flags.Output(), "usage: quote-educator [educate | straighten | check] [flags] [file ...]")
+	printVisibleDefaults(flags)
+}
 
-	if showHelp != nil && *showHelp {
-		flag.PrintDefaults()
-		os.Exit(0)
+// run is main with its arguments, input, and outputs passed in and its exit code passed back out. This way it can be tested, and deferred cleanup (like finishing profiles) happens before the process exits.
+//
+// The first argument can be a subcommand: educate, straighten, or check. Without one, run educates, like it always has.
+//
+// Help and flag-parsing errors go to stderr. Everything else that’s not output goes through the log package.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "educate":
+			return runEducate(args[1:], stdin, stdout, stderr)
+		case "straighten":
+			return runStraighten(args[1:], stdin, stdout, stderr)
+		case "check":
+			return runCheck(args[1:], stdin, stdout, stderr)
+		}
 	}
 
-	continueRewriteThings := false
-	if rewriteInPlace != nil && *rewriteInPlace {
-		switch len(flag.Args()) {
-		case 0:
+	return runEducate(args, stdin, stdout, stderr)
+}
+
+// optionFlags are the flags that say how to educate, as opposed to what to educate or where to put it. The educate and check subcommands both have them, so check checks what educate would actually change.
+type optionFlags struct {
+	quiet, logJSON, guillemetSpace, noHTML, dashes *bool
+	language, mode, stdinFilename                  *string
+}
+
+// addOptionFlags defines the optionFlags on flags.
+func addOptionFlags(flags *flag.FlagSet) optionFlags {
+	return optionFlags{
+		quiet:          flags.Bool("q", false, "don’t log anything about quote marks that might need double-checking"),
+		logJSON:        flags.Bool("log-json", false, "log things that might need double-checking to stderr as lines of JSON, with their kind, line, column, offset, and message"),
+		language:       flags.String("lang", "", "use the quote marks of this BCP-47 language tag, like de or fr-CH"),
+		guillemetSpace: flags.Bool("guillemet-space", false, "put a narrow no-break space just inside double quotation marks, the way French typography wants «\u202FBonjour\u202F»"),
+		noHTML:         flags.Bool("no-html", false, "treat every < as a plain <, never the start of an HTML tag"),
+		dashes:         flags.Bool("dashes", false, "turn a -- standing in for a dash into an en dash, and a --- into an em dash"),
+		mode:           flags.String("mode", "", "read the input as markdown, latex, typst, djot, or text (markdown without HTML); defaults to what -stdin-filename’s extension says, or markdown"),
+		stdinFilename:  flags.String("stdin-filename", "", "the name of the file standard input came from, for picking a -mode"),
+	}
+}
+
+// options returns the Options the flags call for, once they’ve been parsed. JSON logs go to stderr.
+func (of optionFlags) options(stderr io.Writer) (Options, error) {
+	opts := OptionsForLanguage(*of.language)
+	if *of.guillemetSpace {
+		opts.GuillemetSpace = FrenchOptions().GuillemetSpace
+	}
+	opts.Quiet = *of.quiet
+	if *of.logJSON {
+		opts.Log = jsonLog(stderr)
+	}
+	opts.NoHTML = *of.noHTML
+	opts.Dashes = *of.dashes
+
+	mode := *of.mode
+	if mode == "" && *of.stdinFilename != "" {
+		mode = modeForFilename(*of.stdinFilename)
+	}
+	err := applyMode(&opts, mode)
+	return opts, err
+}
+
+// runEducate is the educate subcommand, which is also what you get without a subcommand.
+func runEducate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var whence = stdin
+	var whither = stdout
+
+	flags := flag.NewFlagSet("quote-educator", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { printUsage(flags) }
+
+	rewriteInPlace := flags.Bool("w", false, "write results to (source) files instead of stdout")
+	addExtraNewline := flags.Bool("n", false, "add an extra newline at the end")
+	showHelp := flags.Bool("h", false, "Show help")
+	detectKind := flags.Bool("detect", false, "print whether the input looks like markdown, html, or text, and exit")
+	previewWidth := flags.Int("preview", 0, "print the result wrapped to this many columns in a box, for a quick look, and exit")
+	cpuProfile := flags.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := flags.String("memprofile", "", "write a memory profile to this file")
+	writeBOM := flags.Bool("bom", false, "start the output with a UTF-8 byte-order mark; with -w, files that already start with one keep it unless this is set to false")
+	useEditorConfig := flags.Bool("editorconfig", false, "with -w, use the file’s .editorconfig for its line endings, charset, and final newline")
+	lineMode := flags.Bool("line", false, "educate and write each line as soon as it’s read; quotes don’t carry over between lines")
+	educateFlags := addOptionFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := applyEnvironment(flags, os.LookupEnv); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if *showHelp {
+		printUsage(flags)
+		return 0
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Printf("Couldn’t create CPU profile: %v", err)
+			return 5
+		}
+		defer f.Close()
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Printf("Couldn’t start CPU profile: %v", err)
+			return 5
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	if *memProfile != "" {
+		defer func() {
+			f, err := os.Create(*memProfile)
+			if err != nil {
+				log.Printf("Couldn’t create memory profile: %v", err)
+				return
+			}
+			defer f.Close()
+
+			runtime.GC() // so the profile shows what’s still live
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Printf("Couldn’t write memory profile: %v", err)
+			}
+		}()
+	}
+
+	opts, err := educateFlags.options(stderr)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if *lineMode {
+		if *rewriteInPlace {
+			log.Println("Can’t use -w with -line")
+			return 2
+		}
+		return educateLines(stdin, stdout, opts)
+	}
+
+	opts.WriteBOM = *writeBOM
+
+	if *rewriteInPlace {
+		switch {
+		case len(flags.Args()) == 0:
 			log.Println("Must specify a file to overwrite with -w")
-			os.Exit(2)
-		case 1:
-			// continue
+			return 2
+		case *detectKind || *previewWidth > 0:
+			// Nothing’s getting overwritten, after all.
+			if len(flags.Args()) > 1 {
+				log.Println("Must specify only one file to look at with -w and -detect or -preview")
+				return 3
+			}
+			f, err := os.Open(flags.Args()[0])
+			if err != nil {
+				log.Printf("Couldn’t open file «%s»: %v", flags.Args()[0], err)
+				return 4
+			}
+			defer f.Close()
+			whence = f
 		default:
-			log.Println("Must specify only one file to overwrite with -w")
-			os.Exit(3)
+			// A file that starts with a byte-order mark keeps it, unless -bom=false says to drop it.
+			keepBOM := true
+			flags.Visit(func(f *flag.Flag) {
+				if f.Name == "bom" {
+					keepBOM = false
+				}
+			})
+			return educateFilesInPlace(flags.Args(), opts, *useEditorConfig, *addExtraNewline, keepBOM, stdout)
 		}
+	}
+
+	whenceContents, err := io.ReadAll(whence)
+	if err != nil {
+		log.Println("Something went wrong when reading input: ", err)
+		return 1
+	}
+
+	if *detectKind {
+		fmt.Fprintln(stdout, DetectKind(string(whenceContents)))
+		return 0
+	}
 
-		continueRewriteThings = true
-		var err error
-		whence, err = os.Open(flag.Args()[0])
+	if *previewWidth > 0 {
+		boxed, err := EducateBoxedWithOptions(string(whenceContents), *previewWidth, opts)
 		if err != nil {
-			log.Printf("Could not open file named “%s” for both reading and writing: %v\n", flag.Args()[0], err)
-			os.Exit(4)
+			log.Printf("Couldn’t educate the preview: %v", err)
+			return 1
 		}
+		io.WriteString(stdout, boxed)
+		return 0
 	}
 
-	whenceContents, err := io.ReadAll(whence)
+	N, err := EducateWithOptions(whither, bytes.NewReader(whenceContents), opts)
+	if err != nil {
+		log.Printf("%v bytes written before an error occurred: %v", N, err)
+		return 1
+	}
+
+	if *addExtraNewline {
+		n, err := io.WriteString(whither, "\n")
+		if n != 1 || err != nil {
+			log.Printf("Could not slap on one final newline. Error, if any: %v", err)
+		}
+
+	}
+
+	return 0
+}
+
+// A fileResult is what happened to one of the files -w educated in place.
+type fileResult struct {
+	path    string
+	changed bool
+	err     error
+}
+
+// educateFilesInPlace educates each of paths and writes it back, and for more than one file, prints a summary like «3 changed, 10 unchanged, 1 error» to stdout at the end. A file that fails doesn’t stop the rest from being educated, but it does make the exit code 1.
+func educateFilesInPlace(paths []string, opts Options, useEditorConfig, addExtraNewline, keepBOM bool, stdout io.Writer) int {
+	results := make([]fileResult, 0, len(paths))
+	for _, path := range paths {
+		changed, err := educateFileInPlace(path, opts, useEditorConfig, addExtraNewline, keepBOM)
+		if err != nil {
+			log.Println(err)
+		}
+		results = append(results, fileResult{path: path, changed: changed, err: err})
+	}
+
+	var changed, unchanged, failed int
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			failed++
+		case result.changed:
+			changed++
+		default:
+			unchanged++
+		}
+	}
+
+	if len(paths) > 1 {
+		errorsNoun := "errors"
+		if failed == 1 {
+			errorsNoun = "error"
+		}
+		fmt.Fprintf(stdout, "%d changed, %d unchanged, %d %s\n", changed, unchanged, failed, errorsNoun)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// educateFileInPlace educates the file at path and writes the result back, unless it’s the same as what’s already there, in which case the file isn’t touched at all.
+//
+// If keepBOM is true and the file starts with a byte-order mark, so does what’s written back. An .editorconfig’s charset, when useEditorConfig is true, has the last word either way.
+func educateFileInPlace(path string, opts Options, useEditorConfig, addExtraNewline, keepBOM bool) (changed bool, err error) {
+	contents, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalln("Something went wrong when reading input: ", err)
+		return false, fmt.Errorf("couldn’t read «%s»: %w", path, err)
 	}
 
-	whenceReader := bytes.NewReader(whenceContents)
+	if keepBOM && bytes.HasPrefix(contents, []byte("\uFEFF")) {
+		opts.WriteBOM = true
+	}
 
-	if continueRewriteThings {
-		// now that we’ve got the input all slurped up, let’s set up the out piping
+	var educated bytes.Buffer
+	if _, err := EducateWithOptions(&educated, bytes.NewReader(contents), opts); err != nil {
+		return false, fmt.Errorf("couldn’t educate «%s»: %w", path, err)
+	}
 
-		whither, err = os.OpenFile(flag.Args()[0], os.O_WRONLY|os.O_TRUNC, 0755) // BUG(adiabatic): cargo-culting the “0755”; I don’t understand masks
+	result := educated.Bytes()
+	newline := "\n"
+	if useEditorConfig {
+		ec, err := findEditorConfig(path)
 		if err != nil {
-			log.Printf("Couldn’t open file «%s»: %s", flag.Args()[0], err)
+			return false, fmt.Errorf("couldn’t read .editorconfig for «%s»: %w", path, err)
+		}
+		result = ec.apply(result)
+		if configured := ec.newline(); configured != "" {
+			newline = configured
 		}
+	}
+	if addExtraNewline {
+		result = append(result, newline...)
+	}
 
+	if bytes.Equal(result, contents) {
+		return false, nil
 	}
 
-	N, err := Educate(whither, whenceReader)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0755) // BUG(adiabatic): cargo-culting the “0755”; I don’t understand masks
 	if err != nil {
-		log.Printf("%v bytes written before an error occurred: %v", N, err)
-		os.Exit(1)
+		return false, fmt.Errorf("couldn’t open file «%s»: %w", path, err)
 	}
+	defer f.Close()
 
-	if addExtraNewline != nil && *addExtraNewline {
-		n, err := whither.WriteString("\n")
-		if n != 1 || err != nil {
-			log.Printf("Could not slap on one final newline. Error, if any: %v", err)
+	if _, err := f.Write(result); err != nil {
+		return false, fmt.Errorf("couldn’t write «%s»: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return false, fmt.Errorf("couldn’t flush to «%s»: %w", path, err)
+	}
+
+	return true, nil
+}
+
+// runStraighten is the straighten subcommand. It reads from stdin (or the file given with -w) and writes the input with its curly quotes straightened.
+func runStraighten(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("quote-educator straighten", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	rewriteInPlace := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	apostrophesOnly := flags.Bool("apostrophes", false, "straighten only apostrophes, leaving quotation marks curly (handy for spell checkers)")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
 		}
+		return 2
+	}
 
+	straighten := Straighten
+	if *apostrophesOnly {
+		straighten = StraightenApostrophes
 	}
 
-	// stdout doesn’t like being synced, so don’t do it
-	if whither != os.Stdout {
-		err = whither.Sync()
+	if !*rewriteInPlace {
+		contents, err := io.ReadAll(stdin)
 		if err != nil {
-			log.Printf("couldn’t flush to destination: %v", err)
-			os.Exit(2)
+			log.Println("Something went wrong when reading input: ", err)
+			return 1
+		}
+		if _, err := io.WriteString(stdout, straighten(string(contents))); err != nil {
+			log.Printf("Couldn’t write output: %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(flags.Args()) != 1 {
+		log.Println("Must specify exactly one file to overwrite with -w")
+		return 2
+	}
+
+	path := flags.Args()[0]
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Couldn’t read «%s»: %v", path, err)
+		return 4
+	}
+	if err := os.WriteFile(path, []byte(straighten(string(contents))), 0644); err != nil {
+		log.Printf("Couldn’t write «%s»: %v", path, err)
+		return 4
+	}
+	return 0
+}
+
+// runCheck is the check subcommand. Like gofmt -l, it prints the name of every file that Educate would change and exits with 1 if there were any. Without any files, it checks stdin and just exits with 1 or 0. Flags like -lang and -mode mean the same thing they do to educate.
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("quote-educator check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	checkFlags := addOptionFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if err := applyEnvironment(flags, os.LookupEnv); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	opts, err := checkFlags.options(stderr)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if len(flags.Args()) == 0 {
+		contents, err := io.ReadAll(stdin)
+		if err != nil {
+			log.Println("Something went wrong when reading input: ", err)
+			return 1
+		}
+		n, err := CountChangesWithOptions(string(contents), opts)
+		if err != nil {
+			log.Println("Something went wrong when checking input: ", err)
+			return 4
+		}
+		if n > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	code := 0
+	for _, path := range flags.Args() {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Couldn’t read «%s»: %v", path, err)
+			return 4
+		}
+		// -w keeps a file’s byte-order mark, so it isn’t a change
+		fileOpts := opts
+		fileOpts.WriteBOM = bytes.HasPrefix(contents, []byte("\uFEFF"))
+		n, err := CountChangesWithOptions(string(contents), fileOpts)
+		if err != nil {
+			log.Printf("Couldn’t check «%s»: %v", path, err)
+			return 4
+		}
+		if n > 0 {
+			fmt.Fprintln(stdout, path)
+			code = 1
+		}
+	}
+	return code
+}
+
+// educateLines educates each line from in as soon as it’s read and writes it to out, so whatever’s on the other end of the pipe doesn’t have to wait for EOF.
+func educateLines(in io.Reader, out io.Writer, opts Options) int {
+	br := bufio.NewReader(in)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			educated, educateErr := EducateLine(line, opts)
+			if educateErr != nil {
+				log.Printf("Couldn’t educate line «%s»: %v", line, educateErr)
+				return 1
+			}
+			if _, writeErr := io.WriteString(out, educated); writeErr != nil {
+				log.Printf("Couldn’t write line: %v", writeErr)
+				return 1
+			}
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			log.Println("Something went wrong when reading input: ", err)
+			return 1
 		}
 	}
 }
@@ -832,6 +2734,132 @@ func isASCIIWhitespace(r rune) bool {
 	return false
 }
 
+// indexTagFold is like indexFold, but it only finds needle (a < or </ and a tag name) when the tag name isn’t just the start of a longer one.
+func indexTagFold(haystack []byte, needle string) int {
+	for offset := 0; ; {
+		i := indexFold(haystack[offset:], needle)
+		if i < 0 {
+			return -1
+		}
+		if after := offset + i + len(needle); after == len(haystack) || endsTagName(haystack[after]) {
+			return offset + i
+		}
+		offset += i + 1
+	}
+}
+
+// endsTagName returns true if b can come right after a tag name: whitespace, a >, or the / of a self-closing tag.
+func endsTagName(b byte) bool {
+	return isASCIIWhitespace(rune(b)) || b == '>' || b == '/'
+}
+
+// indexFold is like bytes.Index, but ignores ASCII case.
+func indexFold(haystack []byte, needle string) int {
+	nb := []byte(needle)
+	for i := 0; i+len(nb) <= len(haystack); i++ {
+		if bytes.EqualFold(haystack[i:i+len(nb)], nb) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isASCIIDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// isASCIIPunctuation returns true for the runes CommonMark lets you backslash-escape.
+func isASCIIPunctuation(r rune) bool {
+	return r < utf8.RuneSelf && strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", r)
+}
+
+func isDigitOrSlash(r rune) bool {
+	return unicode.IsDigit(r) || r == '/'
+}
+
+// isClosingPunctuation returns true for anything Unicode calls closing punctuation, like ), ], 」, and ）. A ' right after one of those could be an apostrophe («(see above)'s») or an opening quote, so it’s hard to tell.
+func isClosingPunctuation(r rune) bool {
+	return unicode.Is(unicode.Pe, r)
+}
+
+// isOpeningPunctuation returns true for opening brackets, opening quotes, and dashes, like (, 「, “, and —, which a quotation can start right after.
+func isOpeningPunctuation(r rune) bool {
+	return unicode.In(r, unicode.Ps, unicode.Pi, unicode.Pd)
+}
+
+// isWordBoundary returns true for runes that end the words that wordBefore and wordAfter return.
+//
+// Brackets, braces, and parentheses count so the «It's» in «[It's](https://example.com)» isn’t taken to be part of the URL next to it, and the «it's» in «\emph{it's}» isn’t taken to be a path because of the backslash.
+func isWordBoundary(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("<>[]{}()", r)
+}
+
+// looksLikeURLOrEmail returns true if word has a slash or a backslash in it (URLs and paths) or an @ right after a letter or digit (email addresses, but not @mentions).
+func looksLikeURLOrEmail(word string) bool {
+	if strings.ContainsAny(word, "/\\") {
+		return true
+	}
+
+	var previous rune
+	for _, r := range word {
+		if r == '@' && (unicode.IsLetter(previous) || unicode.IsDigit(previous)) {
+			return true
+		}
+		previous = r
+	}
+	return false
+}
+
+// looksLikeCode returns true if word has an underscore in it, a ( right after a letter, digit, or underscore (as in «f(x)»), or a . between one of those and a lowercase letter (as in «obj.field»). A word like «U.S.» or «end.» doesn’t count.
+func looksLikeCode(word string) bool {
+	isIdentifierRune := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	var previous rune
+	for i, r := range word {
+		switch r {
+		case '_':
+			return true
+		case '(':
+			if isIdentifierRune(previous) {
+				return true
+			}
+		case '.':
+			next, _ := utf8.DecodeRuneInString(word[i+1:])
+			if isIdentifierRune(previous) && (unicode.IsLower(next) || next == '_') {
+				return true
+			}
+		}
+		previous = r
+	}
+	return false
+}
+
+// noncharacters are the runes that can’t go in an HTML attribute name even though they aren’t controls. Full list: https://infra.spec.whatwg.org/#noncharacter
+//
+// It’s built once up here instead of on every call to isLegalHTMLAttributeNameRune, which gets called for every rune of every attribute name.
+var noncharacters = &unicode.RangeTable{
+	R16: []unicode.Range16{{0xfdd0, 0xfdef, 1}, {0xfffe, 0xffff, 1}},
+	// BUG(adiabatic): Erroneously thinks non-BMP noncharacters are characters
+	R32: []unicode.Range32{ // go vet needs the Lo/Hi/Stride as of 2019-06-09
+		{Lo: 0x1fffe, Hi: 0x1ffff, Stride: 1},
+		{Lo: 0x2fffe, Hi: 0x2ffff, Stride: 1},
+		{Lo: 0x3fffe, Hi: 0x3ffff, Stride: 1},
+		{Lo: 0x4fffe, Hi: 0x4ffff, Stride: 1},
+		{Lo: 0x5fffe, Hi: 0x5ffff, Stride: 1},
+		{Lo: 0x6fffe, Hi: 0x6ffff, Stride: 1},
+		{Lo: 0x7fffe, Hi: 0x7ffff, Stride: 1},
+		{Lo: 0x8fffe, Hi: 0x8ffff, Stride: 1},
+		{Lo: 0x9fffe, Hi: 0x9ffff, Stride: 1},
+		{Lo: 0xafffe, Hi: 0xaffff, Stride: 1},
+		{Lo: 0xbfffe, Hi: 0xbffff, Stride: 1},
+		{Lo: 0xcfffe, Hi: 0xcffff, Stride: 1},
+		{Lo: 0xdfffe, Hi: 0xdffff, Stride: 1},
+		{Lo: 0xefffe, Hi: 0xeffff, Stride: 1},
+		{Lo: 0xffffe, Hi: 0xfffff, Stride: 1},
+		{Lo: 0x10fffe, Hi: 0x10ffff, Stride: 1},
+	},
+}
+
 func isLegalHTMLAttributeNameRune(r rune) bool {
 	// https://html.spec.whatwg.org/multipage/syntax.html#syntax-attributes
 	if unicode.IsControl(r) { // should include tab
@@ -843,31 +2871,7 @@ func isLegalHTMLAttributeNameRune(r rune) bool {
 		return false
 	}
 
-	// Full list of noncharacters: https://infra.spec.whatwg.org/#noncharacter
-	table := unicode.RangeTable{
-		R16: []unicode.Range16{{0xfdd0, 0xfdef, 1}, {0xfffe, 0xffff, 1}},
-		// BUG(adiabatic): Erroneously thinks non-BMP noncharacters are characters
-		R32: []unicode.Range32{ // go vet needs the Lo/Hi/Stride as of 2019-06-09
-			{Lo: 0x1fffe, Hi: 0x1ffff, Stride: 1},
-			{Lo: 0x2fffe, Hi: 0x2ffff, Stride: 1},
-			{Lo: 0x3fffe, Hi: 0x3ffff, Stride: 1},
-			{Lo: 0x4fffe, Hi: 0x4ffff, Stride: 1},
-			{Lo: 0x5fffe, Hi: 0x5ffff, Stride: 1},
-			{Lo: 0x6fffe, Hi: 0x6ffff, Stride: 1},
-			{Lo: 0x7fffe, Hi: 0x7ffff, Stride: 1},
-			{Lo: 0x8fffe, Hi: 0x8ffff, Stride: 1},
-			{Lo: 0x9fffe, Hi: 0x9ffff, Stride: 1},
-			{Lo: 0xafffe, Hi: 0xaffff, Stride: 1},
-			{Lo: 0xbfffe, Hi: 0xbffff, Stride: 1},
-			{Lo: 0xcfffe, Hi: 0xcffff, Stride: 1},
-			{Lo: 0xdfffe, Hi: 0xdffff, Stride: 1},
-			{Lo: 0xefffe, Hi: 0xeffff, Stride: 1},
-			{Lo: 0xffffe, Hi: 0xfffff, Stride: 1},
-			{Lo: 0x10fffe, Hi: 0x10ffff, Stride: 1},
-		},
-	}
-
-	return !unicode.In(r, &table)
+	return !unicode.In(r, noncharacters)
 }
 
 func isLegalHTMLAttributeValueUnquoted(r rune) bool {
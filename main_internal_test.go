@@ -0,0 +1,574 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProfileFlags(t *testing.T) {
+	dir := t.TempDir()
+	cpu := filepath.Join(dir, "cpu.pprof")
+	mem := filepath.Join(dir, "mem.pprof")
+
+	var out strings.Builder
+	code := run([]string{"-cpuprofile", cpu, "-memprofile", mem}, strings.NewReader(`It's "fine".`), &out, io.Discard)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	if want := "It’s “fine”."; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+
+	for _, path := range []string{cpu, mem} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", filepath.Base(path))
+		}
+	}
+}
+
+func TestProfileFlagsAreHidden(t *testing.T) {
+	var out strings.Builder
+	if code := run([]string{"-h"}, strings.NewReader(""), io.Discard, &out); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	if strings.Contains(out.String(), "profile") {
+		t.Errorf("expected no profiling flags in the help text, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "-w") {
+		t.Errorf("expected -w in the help text, got:\n%s", out.String())
+	}
+}
+
+func TestLineMode(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	done := make(chan int)
+	go func() {
+		code := run([]string{"-line"}, inR, outW, io.Discard)
+		outW.Close()
+		done <- code
+	}()
+
+	responses := bufio.NewReader(outR)
+	rows := []struct{ In, Want string }{
+		{"It's \"here\".\n", "It’s “here”.\n"},
+		{"\"This one is left open\n", "“This one is left open\n"},
+		{"and this one's new\"\n", "and this one’s new“\n"},
+		{"`'code'`\n", "`'code'`\n"},
+	}
+
+	for _, row := range rows {
+		// Each line has to come back before the next one goes out.
+		if _, err := io.WriteString(inW, row.In); err != nil {
+			t.Fatal(err)
+		}
+		got, err := responses.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != row.Want {
+			t.Errorf("expected «%s», got «%s»", row.Want, got)
+		}
+	}
+
+	io.WriteString(inW, "no newline at the end'")
+	inW.Close()
+
+	rest, err := io.ReadAll(responses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "no newline at the end’"; string(rest) != want {
+		t.Errorf("expected «%s», got «%s»", want, rest)
+	}
+
+	if code := <-done; code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+}
+
+func TestLangFlag(t *testing.T) {
+	var out strings.Builder
+	if code := run([]string{"-lang", "de"}, strings.NewReader(`"It's 'here'"`), &out, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	if want := "„It’s ‚here‘“"; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+}
+
+func TestGuillemetSpaceFlag(t *testing.T) {
+	rows := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-lang", "fr"}, "«Bonjour»"},
+		{[]string{"-lang", "fr", "-guillemet-space"}, "«\u202FBonjour\u202F»"},
+	}
+
+	for _, row := range rows {
+		var out strings.Builder
+		if code := run(row.args, strings.NewReader(`"Bonjour"`), &out, io.Discard); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d", row.args, code)
+		}
+
+		if out.String() != row.want {
+			t.Errorf("%v: expected «%s», got «%s»", row.args, row.want, out.String())
+		}
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	rows := []struct {
+		args []string
+		in   string
+		want string
+		code int
+	}{
+		{nil, `It's "fine".`, "It’s “fine”.", 0},
+		{[]string{"educate"}, `It's "fine".`, "It’s “fine”.", 0},
+		{[]string{"straighten"}, "It’s “fine”.", `It's "fine".`, 0},
+		{[]string{"check"}, `It's "fine".`, "", 1},
+		{[]string{"check"}, "It’s “fine”.", "", 0},
+
+		// check takes the same flags educate does
+		{[]string{"check", "-lang", "de"}, `"fine"`, "", 1},
+		{[]string{"check", "-mode", "latex"}, "``fine'' `x`", "", 0},
+		{[]string{"check", "-dashes"}, "this -- that", "", 1},
+		{[]string{"check", "-mode", "nonsense"}, "x", "", 2},
+	}
+
+	for _, row := range rows {
+		var out strings.Builder
+		code := run(row.args, strings.NewReader(row.in), &out, io.Discard)
+		if code != row.code {
+			t.Errorf("%v: expected exit code %d, got %d", row.args, row.code, code)
+		}
+		if out.String() != row.want {
+			t.Errorf("%v: expected «%s», got «%s»", row.args, row.want, out.String())
+		}
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	straight := filepath.Join(dir, "straight.md")
+	curly := filepath.Join(dir, "curly.md")
+	bom := filepath.Join(dir, "bom.md") // -w keeps the byte-order mark, so this one’s fine, too
+	if err := os.WriteFile(straight, []byte(`It's "fine".`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(curly, []byte("It’s “fine”."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bom, []byte("\uFEFFIt’s “fine”."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if code := run([]string{"check", straight, curly, bom}, strings.NewReader(""), &out, io.Discard); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if want := straight + "\n"; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+}
+
+func TestStraightenInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "curly.md")
+	if err := os.WriteFile(path, []byte("It’s “fine”."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run([]string{"straighten", "-w", path}, strings.NewReader(""), io.Discard, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `It's "fine".`; string(got) != want {
+		t.Errorf("expected «%s», got «%s»", want, got)
+	}
+}
+
+func TestPreviewFlag(t *testing.T) {
+	var out strings.Builder
+	if code := run([]string{"-preview", "5"}, strings.NewReader(`"Hi"`), &out, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	if want := "┌───────┐\n│ “Hi”  │\n└───────┘\n"; out.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	// the other flags still count
+	out.Reset()
+	if code := run([]string{"-preview", "8", "-lang", "de"}, strings.NewReader(`"Hallo"`), &out, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if want := "┌──────────┐\n│ „Hallo“  │\n└──────────┘\n"; out.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	if code := run([]string{"-preview", "8"}, strings.NewReader(`<a b"c">x</a>`), io.Discard, io.Discard); code != 1 {
+		t.Errorf("expected exit code 1 for input that can’t be educated, got %d", code)
+	}
+}
+
+// benchmarkCorpora are repeated to make the documents for BenchmarkBufferedVsStreaming: one with quotes everywhere, and one with hardly any.
+var benchmarkCorpora = map[string]string{
+	"dense":  "\"It's 'here,'\" she said. \"Don't you 'get' it?\" 'Twas the night's end.\n",
+	"sparse": "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur, it's said.\n",
+}
+
+// BenchmarkBufferedVsStreaming compares the two ways the command line educates standard input: the usual one, which reads the whole document before writing any of it, and -line, which writes each line as soon as it’s read. Both go through run, flags and all, so what’s measured is what people actually run. Besides the usual numbers, it reports peak-heap-B/op, the most heap in use at once while educating.
+//
+// Peak heap is measured in one more run after the timed ones, so sampling it doesn’t slow down the throughput numbers. The 50 MB documents take a while: «go test -bench BufferedVsStreaming -benchtime 1x» is plenty.
+func BenchmarkBufferedVsStreaming(b *testing.B) {
+	paths := []struct {
+		name string
+		args []string
+	}{
+		{"buffered", []string{"-q"}},
+		{"streaming", []string{"-q", "-line"}},
+	}
+
+	for _, corpus := range []string{"dense", "sparse"} {
+		for _, size := range []struct {
+			name  string
+			bytes int
+		}{{"1KB", 1 << 10}, {"1MB", 1 << 20}, {"50MB", 50 << 20}} {
+			unit := benchmarkCorpora[corpus]
+			in := []byte(strings.Repeat(unit, size.bytes/len(unit)+1)[:size.bytes])
+			in = in[:bytes.LastIndexByte(in, '\n')+1] // so no line gets cut off in the middle of a quotation
+
+			for _, path := range paths {
+				educate := func() error {
+					if code := run(path.args, bytes.NewReader(in), io.Discard, io.Discard); code != 0 {
+						return fmt.Errorf("run %v exited with %d", path.args, code)
+					}
+					return nil
+				}
+
+				b.Run(fmt.Sprintf("%s/%s/%s", corpus, size.name, path.name), func(b *testing.B) {
+					b.SetBytes(int64(len(in)))
+					b.ReportAllocs()
+
+					for i := 0; i < b.N; i++ {
+						if err := educate(); err != nil {
+							b.Fatal(err)
+						}
+					}
+
+					b.StopTimer()
+					var err error
+					peak := peakHeap(func() { err = educate() })
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.ReportMetric(float64(peak), "peak-heap-B/op")
+				})
+			}
+		}
+	}
+}
+
+// peakHeap runs f and returns the most heap it saw in use while f ran, over and above what was in use beforehand. It samples every millisecond, so it can miss short spikes, but those don’t matter much for documents big enough for peak memory to matter. Sampling stops the world, so don’t call it while a benchmark’s timer is running.
+func peakHeap(f func()) uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	base, peak := m.HeapAlloc, m.HeapAlloc
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&m)
+				if m.HeapAlloc > peak {
+					peak = m.HeapAlloc
+				}
+			}
+		}
+	}()
+
+	f()
+	close(done)
+	wg.Wait()
+
+	runtime.ReadMemStats(&m)
+	if m.HeapAlloc > peak {
+		peak = m.HeapAlloc
+	}
+	return peak - base
+}
+
+func TestNoHTMLFlag(t *testing.T) {
+	var out strings.Builder
+	if code := run([]string{"-no-html"}, strings.NewReader(`x <y "z"`), &out, io.Discard); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	if want := "x <y “z”"; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	env := map[string]string{
+		"QUOTE_EDUCATOR_LANG":   "de",
+		"QUOTE_EDUCATOR_DASHES": "true",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	type Row struct {
+		Args       []string
+		WantLang   string
+		WantDashes bool
+		WantQuiet  bool
+	}
+	rows := []Row{
+		{Args: nil, WantLang: "de", WantDashes: true},
+		{Args: []string{"-lang", "fr"}, WantLang: "fr", WantDashes: true},
+		{Args: []string{"-dashes=false"}, WantLang: "de", WantDashes: false},
+		{Args: []string{"-q"}, WantLang: "de", WantDashes: true, WantQuiet: true},
+	}
+
+	for _, row := range rows {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		language := flags.String("lang", "", "")
+		dashes := flags.Bool("dashes", false, "")
+		quiet := flags.Bool("q", false, "")
+		if err := flags.Parse(row.Args); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := applyEnvironment(flags, lookup); err != nil {
+			t.Fatalf("%v: %v", row.Args, err)
+		}
+		if *language != row.WantLang || *dashes != row.WantDashes || *quiet != row.WantQuiet {
+			t.Errorf("%v: expected lang %q, dashes %v, q %v; got lang %q, dashes %v, q %v", row.Args, row.WantLang, row.WantDashes, row.WantQuiet, *language, *dashes, *quiet)
+		}
+	}
+
+	env["QUOTE_EDUCATOR_DASHES"] = "maybe"
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("lang", "", "")
+	flags.Bool("dashes", false, "")
+	flags.Bool("q", false, "")
+	if err := applyEnvironment(flags, lookup); err == nil {
+		t.Error("expected an error for QUOTE_EDUCATOR_DASHES=maybe")
+	}
+}
+
+func TestEnvironmentVariables(t *testing.T) {
+	t.Setenv("QUOTE_EDUCATOR_LANG", "de")
+	t.Setenv("QUOTE_EDUCATOR_DASHES", "1")
+
+	in := `"this -- that"`
+	for args, want := range map[string]string{
+		"":         "„this – that“",
+		"-lang en": "“this – that”",
+	} {
+		var out strings.Builder
+		if code := run(strings.Fields(args), strings.NewReader(in), &out, io.Discard); code != 0 {
+			t.Fatalf("%q: expected exit code 0, got %d", args, code)
+		}
+		if out.String() != want {
+			t.Errorf("%q: expected «%s», got «%s»", args, want, out.String())
+		}
+	}
+}
+
+func TestModeForFilename(t *testing.T) {
+	for name, want := range map[string]string{
+		"paper.tex":      "latex",
+		"PAPER.TEX":      "latex",
+		"slides.typ":     "typst",
+		"notes.dj":       "djot",
+		"index.html":     "markdown",
+		"README.md":      "markdown",
+		"notes.txt":      "text",
+		"Makefile":       "markdown",
+		"dir.tex/readme": "markdown",
+	} {
+		if got := modeForFilename(name); got != want {
+			t.Errorf("%s: expected %s, got %s", name, want, got)
+		}
+	}
+}
+
+func TestStdinFilename(t *testing.T) {
+	in := `"the formula $x='y'$" <b title="it's">`
+
+	type Row struct {
+		Args []string
+		Want string
+	}
+	rows := []Row{
+		{nil, `“the formula $x=‘y’$” <b title="it's">`},
+		{[]string{"-stdin-filename", "paper.tex"}, `“the formula $x='y'$” <b title=“it’s”>`},
+		{[]string{"-stdin-filename", "notes.txt"}, `“the formula $x=‘y’$” <b title=“it’s”>`},
+		{[]string{"-stdin-filename", "paper.tex", "-mode", "markdown"}, `“the formula $x=‘y’$” <b title="it's">`},
+	}
+
+	for _, row := range rows {
+		var out strings.Builder
+		if code := run(row.Args, strings.NewReader(in), &out, io.Discard); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d", row.Args, code)
+		}
+		if out.String() != row.Want {
+			t.Errorf("%v: expected «%s», got «%s»", row.Args, row.Want, out.String())
+		}
+	}
+
+	if code := run([]string{"-mode", "rtf"}, strings.NewReader(in), io.Discard, io.Discard); code != 2 {
+		t.Errorf("expected exit code 2 for an unknown mode, got %d", code)
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	var stderr strings.Builder
+	if code := run([]string{"-log-json"}, strings.NewReader("Line one.\nHe said (yes)' then"), io.Discard, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(stderr.String()), &entry); err != nil {
+		t.Fatalf("expected a line of JSON, got «%s»: %v", stderr.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"kind":    "ambiguous-quote",
+		"line":    float64(2),
+		"column":  float64(14),
+		"offset":  float64(23),
+		"message": "Found the string «)'»; cannot tell whether this is a quote mark or an apostrophe. Leaving unchanged. Manually inspect subsequent quote marks.",
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("expected %v, got %v", want, entry)
+	}
+
+	// -q still means quiet
+	stderr.Reset()
+	run([]string{"-log-json", "-q"}, strings.NewReader("(yes)'"), io.Discard, &stderr)
+	if stderr.Len() != 0 {
+		t.Errorf("expected nothing logged, got «%s»", stderr.String())
+	}
+}
+
+func TestRewriteManyFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"straight.md": `It's "here".`,
+		"curly.md":    "It’s “here”.",
+		"broken.md":   `<code>"never closed`,
+	}
+	var paths []string
+	for _, name := range []string{"straight.md", "curly.md", "broken.md", "missing.md"} {
+		path := filepath.Join(dir, name)
+		paths = append(paths, path)
+		if contents, ok := files[name]; ok {
+			if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var out strings.Builder
+	if code := run(append([]string{"-w", "-q"}, paths...), strings.NewReader(""), &out, io.Discard); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if want := "1 changed, 1 unchanged, 2 errors\n"; out.String() != want {
+		t.Errorf("expected «%s», got «%s»", want, out.String())
+	}
+
+	for name, want := range map[string]string{
+		"straight.md": "It’s “here”.",
+		"curly.md":    "It’s “here”.",
+		"broken.md":   `<code>"never closed`,
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected «%s», got «%s»", name, want, got)
+		}
+	}
+
+	// One file doesn’t need a summary.
+	out.Reset()
+	if code := run([]string{"-w", paths[0]}, strings.NewReader(""), &out, io.Discard); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	if out.String() != "" {
+		t.Errorf("expected no output, got «%s»", out.String())
+	}
+}
+
+func TestRewriteKeepsBOM(t *testing.T) {
+	rows := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-w"}, "\uFEFF“Hi”"},
+		{[]string{"-w", "-bom"}, "\uFEFF“Hi”"},
+		{[]string{"-w", "-bom=false"}, "“Hi”"},
+	}
+
+	for _, row := range rows {
+		path := filepath.Join(t.TempDir(), "bom.md")
+		if err := os.WriteFile(path, []byte("\uFEFF\"Hi\""), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if code := run(append(row.args, path), strings.NewReader(""), io.Discard, io.Discard); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d", row.args, code)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != row.want {
+			t.Errorf("%v: expected «%s», got «%s»", row.args, row.want, got)
+		}
+	}
+}
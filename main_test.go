@@ -4,8 +4,13 @@ package main_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"log"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	quotes "github.com/adiabatic/quote-educator"
@@ -24,11 +29,41 @@ func EducateString(s string) (string, error) {
 	return out.String(), nil
 }
 
+// EducateStringWithOptions is a convenience function for running EducateWithOptions on strings.
+func EducateStringWithOptions(s string, opts quotes.Options) (string, error) {
+	br := bytes.NewReader([]byte(s))
+	out := &strings.Builder{}
+
+	_, err := quotes.EducateWithOptions(out, br, opts)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
 type Row struct {
 	In   string
 	Want string
 }
 
+// testRowsWithOptions checks that each row’s In educates to its Want under opts.
+func testRowsWithOptions(t *testing.T, rows []Row, opts quotes.Options) {
+	t.Helper()
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			got, err := EducateStringWithOptions(row.In, opts)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != row.Want {
+				t.Errorf("\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", row.In, row.Want, got)
+			}
+		})
+	}
+}
+
 func TestStrings(t *testing.T) {
 	rows := []Row{
 		// Absolute basics
@@ -38,6 +73,13 @@ func TestStrings(t *testing.T) {
 
 		// Don’t swallow trailing newlines
 		{"hello\n", "hello\n"},
+
+		// …or whatever’s before a lone mark at the very end
+		{`a "`, `a “`},
+		{"a '", "a ‘"},
+		{"a `", "a `"},
+		{`"`, `“`},
+		{"a \"\n", "a “\n"},
 		{"hello\n\n", "hello\n\n"},
 
 		// Don’t swallow trailing spaces, either
@@ -49,6 +91,12 @@ func TestStrings(t *testing.T) {
 			"Some Europeans use \\` instead of ‘ when they’re typing in English.",
 		},
 
+		// Backslash-escaped quotes stay straight (and escaped) without closing the quotation they’re in
+		{`"he said \"hi\" loudly"`, `“he said \"hi\" loudly”`},
+		{`'it\'s \'this\' one'`, `‘it\'s \'this\' one’`},
+		{`"a backslash \\" and "another"`, `“a backslash \\” and “another”`},
+		{`\"not a quotation\"`, `\"not a quotation\"`},
+
 		// Double-quoty things
 		{
 			`I like "sarcasm quotes".`,
@@ -77,10 +125,40 @@ func TestStrings(t *testing.T) {
 			`“‘Tell him I said “ow”’. Gotcha!”`,
 		},
 
+		// Single quotes that close right before a closing double quote
+		{`"he said 'hi'"`, `“he said ‘hi’”`},
+		{`"nested 'quote'" and more`, `“nested ‘quote’” and more`},
+		{`"'hi'"`, `“‘hi’”`},
+		{`"'nested'"`, `“‘nested’”`},
+		{`"'nested'" and 'after' "too"`, `“‘nested’” and ‘after’ “too”`},
+		{`"'one' 'two'"`, `“‘one’ ‘two’”`},
+		{`"'nested.'"`, `“‘nested.’”`},
+		{"\"'nested'\"\n\n\"next\"", "“‘nested’”\n\n“next”"},
+
 		// Single-quoty things
 		{"Maybe I'd like lunch.", "Maybe I’d like lunch."},
 		{"I like 'scare quotes'.", "I like ‘scare quotes’."},
 
+		// Leave quote marks alone inside email addresses, paths, and URLs
+		{"Email o'brien@example.com about it.", "Email o'brien@example.com about it."},
+		{"Write to 'o'brien@example.com' today.", "Write to ‘o'brien@example.com’ today."},
+		{"It's in C:\\Users\\o'brien now.", "It’s in C:\\Users\\o'brien now."},
+		{"See https://example.com/it's-here for more.", "See https://example.com/it's-here for more."},
+		{"[It's here](https://example.com/it's) (https://example.com/it's)", "[It’s here](https://example.com/it's) (https://example.com/it's)"},
+		{"Ask @dan's team.", "Ask @dan’s team."},
+		{`"@dan's" reply`, `“@dan’s” reply`},
+		{"<b>it's</b> fine", "<b>it’s</b> fine"},
+
+		// Single quotes at the very start of the document
+		{"'quoted' at the start", "‘quoted’ at the start"},
+		{"'twas brillig", "’twas brillig"},
+		{"'Tis the season. 'Twas the night.", "’Tis the season. ’Twas the night."},
+		{"Tell 'em 'til it's done.", "Tell ’em ’til it’s done."},
+		{"'emphasis' isn't an elision", "‘emphasis’ isn’t an elision"},
+		{"rock 'n' roll", "rock ’n’ roll"},
+		{"Rock 'N' Roll", "Rock ’N’ Roll"},
+		{"'night 'n' day' is", "‘night ’n’ day’ is"},
+
 		// Ensure apostrophes after single quotes do the right thing
 		{
 			"'I like traffic lights' isn't an example of an interrogative sentence. 'Is this a sheep?' is.",
@@ -102,6 +180,34 @@ func TestStrings(t *testing.T) {
 			"---\ntitle: 'Zelda: Breath of the Wild vignettes'\n---\n\nYou can’t just fall on a horse.\n",
 		},
 
+		// A --- inside a YAML value is indented, so it doesn’t end the front matter
+		{
+			"---\ndescription: |\n  It's one thing.\n  ---\n  It's another.\nquote: \"a\n  --- b\"\n---\n\n\"Done.\"\n",
+			"---\ndescription: |\n  It's one thing.\n  ---\n  It's another.\nquote: \"a\n  --- b\"\n---\n\n“Done.”\n",
+		},
+
+		// Windows line endings
+		{
+			"---\r\ntitle: 'x'\r\n---\r\n\r\nYou can't just fall on a horse.\r\n",
+			"---\r\ntitle: 'x'\r\n---\r\n\r\nYou can’t just fall on a horse.\r\n",
+		},
+
+		// Documents that are nothing but front matter
+		{"---\ntitle: 'x'\n---\n", "---\ntitle: 'x'\n---\n"},
+		{"---\ntitle: 'x'\n---", "---\ntitle: 'x'\n---"},
+		{"---\ntitle: 'x'\n---\n\n", "---\ntitle: 'x'\n---\n\n"},
+
+		// Three hyphens glued to text don’t start YAML front matter
+		{
+			"---notfrontmatter\nYou can't miss it.\n",
+			"---notfrontmatter\nYou can’t miss it.\n",
+		},
+		{"---", "---"},
+
+		// Neither do one or two
+		{"- item's first\n- 'second'", "- item’s first\n- ‘second’"},
+		{"-- it's not front matter\n---\n", "-- it’s not front matter\n---\n"},
+
 		// Horizontal rules aren’t YAML front matter
 		{
 			"Let's take a breather.\n\n---\n\nWasn't that nice?.",
@@ -120,12 +226,64 @@ func TestStrings(t *testing.T) {
 			"I’d like to show you my first:\n\n```\nprint 'Hello, world!'\n```\n\nWasn’t that difficult?",
 		},
 
+		// Unicode brackets and dashes work like ASCII ones next to quotes
+		{"（'hi'） and 「'quoted'」", "（‘hi’） and 「‘quoted’」"},
+		{"—'Hi,' she said—\"bye.\"", "—‘Hi,’ she said—“bye.”"},
+		{"It's (see above)'s and 【above】's", "It’s (see above)'s and 【above】's"},
+		{"'“Nested,” she said'", "‘“Nested,” she said’"},
+
+		// A quote right after an end tag that comes right after a letter is an apostrophe
+		{"<a>Twain</a>'s autobiography", "<a>Twain</a>’s autobiography"},
+		{"the <b>cats</b>' toys", "the <b>cats</b>’ toys"},
+		{"<i><b>Twain</b></i>'s", "<i><b>Twain</b></i>’s"},
+		{"<i>word</i> 'quote'", "<i>word</i> ‘quote’"},
+		{"'Read <a>Twain</a>'s book,' she said.", "‘Read <a>Twain</a>’s book,’ she said."},
+		{"'Read <i>Twain</i>' first", "‘Read <i>Twain</i>’ first"},
+
+		// … but only if it’s really right after the end tag
+		{"x</b> a >'hi'", "x</b> a >‘hi’"},
+		{"<b>Bob</b> wrote >'hi'", "<b>Bob</b> wrote >‘hi’"},
+		{"</b>\n>'hi'", "</b>\n>‘hi’"},
+		{"<b>Bob</b>\n>'hi'", "<b>Bob</b>\n>‘hi’"},
+		{"<a>Twain</a >'s", "<a>Twain</a >’s"},
+
+		// Closing fences can be indented by up to three spaces
+		{"```\n\tcode 'here'\n   ```\nIt's out.", "```\n\tcode 'here'\n   ```\nIt’s out."},
+		{"```\n  x = 'a'\n    ```\n'still code'\n```\nIt's out.", "```\n  x = 'a'\n    ```\n'still code'\n```\nIt’s out."},
+		{"```\n'a'\n``` \t\n'b'", "```\n'a'\n``` \t\n‘b’"},
+		{"```\n'a'\n```not a fence\n```\n'b'", "```\n'a'\n```not a fence\n```\n‘b’"},
+		{"```\nx\n```\u3000\n\"Hi\" there.", "```\nx\n```\u3000\n\"Hi\" there."},
+		{"```\nx\n```\u3000\n\"Hi\" there.\n```\n\"Hi\" there.", "```\nx\n```\u3000\n\"Hi\" there.\n```\n“Hi” there."},
+		{"```\n```\n'empty'", "```\n```\n‘empty’"},
+
+		// Closing fences have to be at least as long as opening ones
+		{"```\n'a'\n````\n'b'", "```\n'a'\n````\n‘b’"},
+		{"````\n'a'\n```\n'still code'\n````\n'b'", "````\n'a'\n```\n'still code'\n````\n‘b’"},
+		{"`````md\n````\n'a'\n````\n`````\nIt's out.", "`````md\n````\n'a'\n````\n`````\nIt’s out."},
+
+		// Fenced code blocks can start the document
+		{"```\ncode 'here'\n```\n", "```\ncode 'here'\n```\n"},
+		{"```\ncode 'here'\n```", "```\ncode 'here'\n```"},
+		{"```python\nprint(\"it's\")\n```\n\nIt's done.", "```python\nprint(\"it's\")\n```\n\nIt’s done."},
+
+		// Unbalanced quotes in code blocks don’t leak out into the prose after them
+		{"```\nprintf(\"hi\n```\n\"Then\" it's 'fine'.", "```\nprintf(\"hi\n```\n“Then” it’s ‘fine’."},
+		{"Before:\n\n```c\nprintf(\"hi\\n);\n```\n\nAfter, \"quotes\" curl.", "Before:\n\n```c\nprintf(\"hi\\n);\n```\n\nAfter, “quotes” curl."},
+		{"  ```\n  puts 'oops\n  ```\n'Clean' now", "  ```\n  puts 'oops\n  ```\n‘Clean’ now"},
+
 		// Gotta curl quotes after the code span is over.
 		{
 			"`⌘⇥` isn't very different from Windows, but…",
 			"`⌘⇥` isn’t very different from Windows, but…",
 		},
 
+		// Backticks that never get closed are just backticks
+		{
+			"Press ` and then \"Enter\" if you're sure.",
+			"Press ` and then “Enter” if you’re sure.",
+		},
+		{"It's `unclosed", "It’s `unclosed"},
+
 		// Backslashed backticks in code spans
 		{
 			"`⌘\\`` isn't easy to get used to",
@@ -138,6 +296,11 @@ func TestStrings(t *testing.T) {
 			"“`\\`ls\\` # I don't know what I'm doing`” was the comment he’d written all those years ago?",
 		},
 
+		// HTML in code spans isn’t HTML, but HTML in quotes is
+		{"`<b>` isn't bold, and neither is `<a title=\"x\">`", "`<b>` isn’t bold, and neither is `<a title=\"x\">`"},
+		{`"<b>bold</b>" isn't 'plain'`, `“<b>bold</b>” isn’t ‘plain’`},
+		{`"it's <i>very</i> 'nested'"`, `“it’s <i>very</i> ‘nested’”`},
+
 		// Handle uninteresting HTML elements sensibly
 		{
 			`"What's it called? Dymaxion margarita?" "Close. <i>Dymondia margaretae</i>."`,
@@ -162,12 +325,50 @@ func TestStrings(t *testing.T) {
 			"<p hidden>I’m a spooky ghost. OooOoOoooo.</p>",
 		},
 
+		// Prose inside block-level HTML gets educated, and quotes stay open across nested tags
+		{"<div>It's great</div>", "<div>It’s great</div>"},
+		{`<div><span>"quoted"</span></div>`, `<div><span>“quoted”</span></div>`},
+		{`<div><div><div><span>"deep"</span></div></div></div>`, `<div><div><div><span>“deep”</span></div></div></div>`},
+		{`<div>"open <span class="x">and</span> shut"</div> "again"`, `<div>“open <span class="x">and</span> shut”</div> “again”`},
+		{`<div class="box"><span title="it's">"x"</span></div>`, `<div class="box"><span title="it's">“x”</span></div>`},
+		{"<ul><li>\"one\"</li><li>'two'</li></ul>", "<ul><li>“one”</li><li>‘two’</li></ul>"},
+		{"<div>\n<p>\"one\ntwo\"</p>\n</div>", "<div>\n<p>“one\ntwo”</p>\n</div>"},
+		{`<div><code><span>"x"</span></code> "y"</div>`, `<div><code><span>"x"</span></code> “y”</div>`},
+
 		// Handle space after empty attributes
 		{
 			"<input disabled  >∂sn't this illegal HTML?</input>",
 			"<input disabled  >∂sn’t this illegal HTML?</input>",
 		},
 
+		// Bare and incomplete ampersands are just text
+		{"Tom & Jerry's", "Tom & Jerry’s"},
+		{"&amp", "&amp"},
+		{"&amp it's", "&amp it’s"},
+		{"it's &", "it’s &"},
+		{`AT&T's "deal"`, `AT&T’s “deal”`},
+		{"&quot;hi&quot; 'x'", "&quot;hi&quot; ‘x’"},
+
+		// Code in attribute values stays as it is, angle brackets and all
+		{`<button onclick="if(a<b){alert('hi')}">Don't</button> 'x'`, `<button onclick="if(a<b){alert('hi')}">Don’t</button> ‘x’`},
+		{`<a onclick='say("hi")' title="a>b">It's</a>`, `<a onclick='say("hi")' title="a>b">It’s</a>`},
+
+		// Tag names can have digits and hyphens after the first letter, and can be in any case
+		{"<h1>It's</h1>", "<h1>It’s</h1>"},
+		{"<x-3 a=b>'hi'</x-3>", "<x-3 a=b>‘hi’</x-3>"},
+		{"<my-element2>it's</my-element2>", "<my-element2>it’s</my-element2>"},
+		{`<DIV CLASS="x">"Hi"</DIV>`, `<DIV CLASS="x">“Hi”</DIV>`},
+		{"<CODE>'x'</CODE> 'y'", "<CODE>'x'</CODE> ‘y’"},
+		{"<Code>'x'</cODE> 'y'", "<Code>'x'</cODE> ‘y’"},
+		{"<CODE>«'x'» — ∆</CODE> 'y'", "<CODE>«'x'» — ∆</CODE> ‘y’"},
+
+		// Handle hyphenated and namespaced attribute names
+		{`<div data-x="1" xml:lang="en">It's "here"</div>`, `<div data-x="1" xml:lang="en">It’s “here”</div>`},
+		{`<span data-tooltip='it"s' aria-label="don't">It's</span>`, `<span data-tooltip='it"s' aria-label="don't">It’s</span>`},
+		{`<svg xmlns:xlink="x"><a xlink:href="#a">"link"</a></svg> "after"`, `<svg xmlns:xlink="x"><a xlink:href="#a">"link"</a></svg> “after”`},
+		{`<div data-x=1 data-empty xml:lang=en>"ok"</div>`, `<div data-x=1 data-empty xml:lang=en>“ok”</div>`},
+		{`<img src="x" alt="it's" />"Hi"`, `<img src="x" alt="it's" />“Hi”`},
+
 		// Handle double-quoted attributes
 		{
 			`<abbr title="YAML Ain't Markup Language">YAML</abbr> isn't bad.`,
@@ -197,6 +398,19 @@ func TestStrings(t *testing.T) {
 			`<abbr id=yaml title="YAML Ain't Markup Language">YAML</abbr> ain't the worst.`,
 			`<abbr id=yaml title="YAML Ain't Markup Language">YAML</abbr> ain’t the worst.`,
 		},
+
+		// Apostrophes inside single quotes have letters on both sides; closing quotes don’t
+		{`'he said "hi".'`, `‘he said “hi”.’`},
+		{"'don't worry'", "‘don’t worry’"},
+		{"'it's 3 o'clock'", "‘it’s 3 o’clock’"},
+		{"'you won't.' Right?", "‘you won’t.’ Right?"},
+		{"'shouldn't've'", "‘shouldn’t’ve’"},
+		{"'I can't won't shan't stop'", "‘I can’t won’t shan’t stop’"},
+
+		// A quote with a space before it and a letter after it opens a quotation inside a single-quoted one
+		{"'it's a 'nested' thing'", "‘it’s a ‘nested’ thing’"},
+		{"'see ('this') here'", "‘see (‘this’) here’"},
+		{"'I told 'em so'", "‘I told ’em so’"},
 	}
 
 	for _, row := range rows {
@@ -211,3 +425,1068 @@ func TestStrings(t *testing.T) {
 		})
 	}
 }
+
+// TestQuotesAfterClosingPunctuation makes sure a ' right after a ) or a > is left alone, since it could be a closing quote or an apostrophe, unless the > ends a start tag, which only an opening quote would come right after.
+func TestQuotesAfterClosingPunctuation(t *testing.T) {
+	rows := []Row{
+		{"(see above)'s", "(see above)'s"},
+		{"It's (here)'", "It’s (here)'"},
+		{"<p>'Hi,' I said.</p>", "<p>‘Hi,’ I said.</p>"},
+		{"<br>'Hi'", "<br>‘Hi’"},
+
+		// a > that doesn’t end an end tag isn’t closing anything, so a quote can open right after it
+		{"1 >'s", "1 >‘s"},
+		{"<p>1 >'s", "<p>1 >‘s"},
+		{"<p>x\n>'y' z", "<p>x\n>‘y’ z"},
+		{"<p>x\n> 'y' z", "<p>x\n> ‘y’ z"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestEducateText(t *testing.T) {
+	rows := []Row{
+		{`a < b "quote"`, `a &lt; b “quote”`},
+		{"Tom & Jerry's", "Tom &amp; Jerry’s"},
+		{"<b>isn't</b> bold", "&lt;b&gt;isn’t&lt;/b&gt; bold"},
+		{"`code` isn't special", "`code` isn’t special"},
+	}
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			got := quotes.EducateText(row.In)
+			if got != row.Want {
+				t.Errorf("\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", row.In, row.Want, got)
+			}
+		})
+	}
+}
+
+func TestSwappedSingleQuotes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.OpenSingle, opts.CloseSingle = opts.CloseSingle, opts.OpenSingle
+
+	rows := []Row{
+		{"I like 'scare quotes'.", "I like ’scare quotes‘."},
+		{"Maybe I'd like lunch.", "Maybe I’d like lunch."},
+		{"'So you're saying I can't?'", "’So you’re saying I can’t?‘"},
+		{`"He said 'hi'"`, `“He said ’hi‘”`},
+		{"'rock 'n' roll'", "’rock ’n’ roll‘"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
+
+func TestFractions(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Fractions = true
+
+	rows := []Row{
+		{"1/2 cup", "½ cup"},
+		{"Add 1/4 cup, then 3/4 cup.", "Add ¼ cup, then ¾ cup."},
+		{"It's 1/2", "It’s ½"},
+		{"on 1/2/2020", "on 1/2/2020"},
+		{"11/2 and 1/20", "11/2 and 1/20"},
+		{"see docs/1/4/ for more", "see docs/1/4/ for more"},
+		{"1/3 isn't common enough", "1/3 isn’t common enough"},
+		{"`1/2`", "`1/2`"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default
+	testRowsWithOptions(t, []Row{{"1/2 cup", "1/2 cup"}}, quotes.DefaultOptions())
+}
+
+func TestCollapseSpaces(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.CollapseSpaces = true
+
+	rows := []Row{
+		{"a.  b", "a. b"},
+		{"It's   three.    Four!", "It’s three. Four!"},
+		{"  - indented list item", "  - indented list item"},
+		{"hard  \nbreak", "hard  \nbreak"},
+		{"trailing   ", "trailing   "},
+		{"`a  b`  c", "`a  b` c"},
+		{"Code:\n\n```\nx  =  1\n```\n\nDone.  Really.", "Code:\n\n```\nx  =  1\n```\n\nDone. Really."},
+		{`<abbr   title="a  b">A  B</abbr>`, `<abbr   title="a  b">A B</abbr>`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default
+	testRowsWithOptions(t, []Row{{"a.  b", "a.  b"}}, quotes.DefaultOptions())
+}
+
+func TestTemplateDelimiters(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.TemplateDelimiters = []string{"{{", "}}", "{%", "%}"}
+
+	rows := []Row{
+		{`It's {{ x == "y" }} and "z".`, `It’s {{ x == "y" }} and “z”.`},
+		{`{% if page.title == 'Home' %}Don't{% endif %}`, `{% if page.title == 'Home' %}Don’t{% endif %}`},
+		{`"{{ name }}" isn't here`, `“{{ name }}” isn’t here`},
+		{`a {single} brace isn't a tag`, `a {single} brace isn’t a tag`},
+		{`{{ unclosed "tag`, `{{ unclosed "tag`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Other handlers for the same rune still work
+	opts.TemplateDelimiters = []string{"<%", "%>"}
+	testRowsWithOptions(t, []Row{
+		{`<% puts "hi" %> <i>it's</i>`, `<% puts "hi" %> <i>it’s</i>`},
+	}, opts)
+}
+
+func TestPrimes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Primes = true
+
+	rows := []Row{
+		{`She's 5' 6".`, `She’s 5′ 6″.`},
+		{`a 36" waist`, `a 36″ waist`},
+		{`he was "5' 6" tall"`, `he was “5′ 6″ tall”`},
+		{`"I'm 6' 2"`, `“I’m 6′ 2”`},
+		{`"I'm 6' 2" and that's that.`, `“I’m 6′ 2” and that’s that.`},
+		{`"Sheet 2" is done.`, `“Sheet 2” is done.`},
+		{`'over 9'`, `‘over 9’`},
+		{`'a 9' pole'`, `‘a 9′ pole’`},
+		{`6'`, `6′`},
+		{`5'10"`, `5′10″`},
+		{`He's 5'10" tall.`, `He’s 5′10″ tall.`},
+		{`"I'm 6'," he said.`, `“I’m 6′,” he said.`},
+		{`it's`, `it’s`},
+
+		// a ' after a digit and before a letter is an apostrophe
+		{`the 1990's`, `the 1990’s`},
+		{`'all the 4's'`, `‘all the 4’s’`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default, so quotations that end in numbers close where they should, but the 1990's still get an apostrophe
+	testRowsWithOptions(t, []Row{
+		{`a 36" waist`, `a 36“ waist`},
+		{`the 1990's`, `the 1990’s`},
+		{`She said "The year was 1999" and then "left".`, `She said “The year was 1999” and then “left”.`},
+		{`"Top 10" lists are "fun".`, `“Top 10” lists are “fun”.`},
+	}, quotes.DefaultOptions())
+}
+
+func TestWriteBOM(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.WriteBOM = true
+
+	rows := []Row{
+		{"It's here.", "\uFEFFIt’s here."},
+		{"\uFEFFIt's here.", "\uFEFFIt’s here."},
+		{"---\ntitle: \"It's\"\n---\n\"Hi\"", "\uFEFF---\ntitle: \"It's\"\n---\n“Hi”"},
+		{"\uFEFF---\ntitle: \"It's\"\n---\n\"Hi\"", "\uFEFF---\ntitle: \"It's\"\n---\n“Hi”"},
+		{"", "\uFEFF"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	got, err := EducateStringWithOptions("'hi'", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "\xEF\xBB\xBF") {
+		t.Errorf("expected output to start with EF BB BF, got % X", got)
+	}
+
+	// Without WriteBOM, an input BOM gets dropped
+	testRowsWithOptions(t, []Row{{"\uFEFF---\na: 'b'\n---\n'c'", "---\na: 'b'\n---\n‘c’"}}, quotes.DefaultOptions())
+}
+
+// TestQuotesAtStartOfDocument makes sure quotes right at the start of a document, or with nothing but whitespace or a byte-order mark before them, open quotations like they do anywhere else, even though there’s no previous letter (or anything at all) to look at.
+func TestQuotesAtStartOfDocument(t *testing.T) {
+	rows := []Row{
+		{`"quote"`, `“quote”`},
+		{`   "quote"`, `   “quote”`},
+		{"\t'quote'", "\t‘quote’"},
+		{"\n\n  \"quote\"", "\n\n  “quote”"},
+		{"\uFEFF\"quote\"", "“quote”"},
+		{"\uFEFF'quote'", "‘quote’"},
+		{"\uFEFF   \"it's\"", "   “it’s”"},
+		{"   'tis the season", "   ’tis the season"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	// The BOM WriteBOM writes doesn’t count as something before the quote, either.
+	opts := quotes.DefaultOptions()
+	opts.WriteBOM = true
+	testRowsWithOptions(t, []Row{{"\uFEFF  'quote'", "\uFEFF  ‘quote’"}}, opts)
+}
+
+func TestGlyphConstants(t *testing.T) {
+	want := string([]rune{quotes.LeftDoubleQuote, quotes.LeftSingleQuote, 'I', quotes.Apostrophe, 'm', ' ', '6', quotes.Prime, ' ', '2', quotes.DoublePrime, quotes.RightSingleQuote, quotes.RightDoubleQuote})
+
+	opts := quotes.DefaultOptions()
+	opts.Primes = true
+	testRowsWithOptions(t, []Row{{`"'I'm 6' 2"'"`, want}}, opts)
+
+	if quotes.Apostrophe != quotes.RightSingleQuote {
+		t.Errorf("expected the apostrophe and the right single quote to be the same character")
+	}
+
+	if got := string([]rune{quotes.EmDash, quotes.EnDash, quotes.Ellipsis}); got != "—–…" {
+		t.Errorf("expected «—–…», got «%s»", got)
+	}
+}
+
+func TestNumberRangeDashes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.NumberRangeDashes = true
+
+	rows := []Row{
+		{"pages 10-20", "pages 10–20"},
+		{"from 2019-2023.", "from 2019–2023."},
+		{"(1-3)", "(1–3)"},
+		{"Call 555-1234.", "Call 555-1234."},
+		{"Call 555-123-4567.", "Call 555-123-4567."},
+		{"on 2019-10-14", "on 2019-10-14"},
+		{"a COVID-19 test", "a COVID-19 test"},
+		{"version 1.2-3", "version 1.2-3"},
+		{"1-2.5 cups", "1-2.5 cups"},
+		{"score: 3-2 and \"10-20\"", "score: 3–2 and “10–20”"},
+		{"a well-known fact", "a well-known fact"},
+		{"`10-20`", "`10-20`"},
+		{"---\npages: 10-20\n---\npages 10-20", "---\npages: 10-20\n---\npages 10–20"},
+		{"- 10-20 pages\n-- 1-3 more", "- 10–20 pages\n-- 1–3 more"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default
+	testRowsWithOptions(t, []Row{{"pages 10-20", "pages 10-20"}}, quotes.DefaultOptions())
+}
+
+func TestRawTextElements(t *testing.T) {
+	rows := []Row{
+		{"Press <kbd>'q'</kbd> to quit. It's easy.", "Press <kbd>'q'</kbd> to quit. It’s easy."},
+		{`<kbd>"q" to quit</kbd> and "done"`, `<kbd>"q" to quit</kbd> and “done”`},
+		{`It says <samp>can't open "x"</samp> and that's that.`, `It says <samp>can't open "x"</samp> and that’s that.`},
+		{`<samp class="out">'ok'</samp> 'ok'`, `<samp class="out">'ok'</samp> ‘ok’`},
+		{`<code>"x"</code> "y"`, `<code>"x"</code> “y”`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	opts := quotes.DefaultOptions()
+	opts.RawTextElements = []string{"code", "var"}
+
+	testRowsWithOptions(t, []Row{
+		{`<kbd>'q'</kbd> <var>'n'</var> <code>'c'</code>`, `<kbd>‘q’</kbd> <var>'n'</var> <code>'c'</code>`},
+	}, opts)
+}
+
+func TestUnclosedCodeElement(t *testing.T) {
+	in := "Here's <code>unclosed 'code'\n\nAnd \"more\" prose."
+
+	_, err := EducateString(in)
+	if err == nil {
+		t.Fatal("expected an error for a <code> element that’s never closed")
+	}
+	if want := "the <code> start tag on line 1 is never closed with a </code> end tag"; err.Error() != want {
+		t.Errorf("expected «%s», got «%s»", want, err)
+	}
+
+	opts := quotes.DefaultOptions()
+	opts.Lenient = true
+	testRowsWithOptions(t, []Row{
+		{in, "Here’s <code>unclosed ‘code’\n\nAnd “more” prose."},
+		{`<kbd class="k">'q'`, `<kbd class="k">‘q’`},
+		{`<code>"closed"</code> "fine"`, `<code>"closed"</code> “fine”`},
+	}, opts)
+}
+
+func TestUnterminatedAttributeValue(t *testing.T) {
+	for in, want := range map[string]string{
+		`<a title="unterminated`:       `the attribute value starting with the " on line 1 is never closed`,
+		"It's\n<a title='not \"here\"": `the attribute value starting with the ' on line 2 is never closed`,
+	} {
+		_, err := EducateString(in)
+		if err == nil {
+			t.Errorf("expected an error for «%s»", in)
+			continue
+		}
+		if err.Error() != want {
+			t.Errorf("expected «%s», got «%s»", want, err)
+		}
+	}
+
+	// A value that does get closed, in a tag that doesn’t, is just the end of the input
+	closedValues := []Row{
+		{`<a title="x"`, `<a title="x"`},
+		{`<a title='x'`, `<a title='x'`},
+		{`"Hi" <a title="x"`, `“Hi” <a title="x"`},
+		{`<a title="x" `, `<a title="x" `},
+		{`<a hidden`, `<a hidden`},
+	}
+	testRowsWithOptions(t, closedValues, quotes.DefaultOptions())
+
+	opts := quotes.DefaultOptions()
+	opts.Lenient = true
+	testRowsWithOptions(t, closedValues, opts)
+	testRowsWithOptions(t, []Row{
+		{`<a title="unterminated`, `<a title="unterminated`},
+		{`"Hi" <a title="it's 'here'`, `“Hi” <a title="it's 'here'`},
+		{`<a title=unquoted`, `<a title=unquoted`},
+		{`<a title="closed">'fine'`, `<a title="closed">‘fine’`},
+	}, opts)
+
+	// the same goes for attribute values that are being educated
+	opts.SkipContexts = []quotes.Context{quotes.ContextInlineCode, quotes.ContextCodeBlock}
+	testRowsWithOptions(t, []Row{
+		{`<a title="it's`, `<a title="it's`},
+	}, opts)
+}
+
+func TestDegenerateEndTags(t *testing.T) {
+	rows := []Row{
+		{`</> "hi"`, `</> “hi”`},
+		{`</ > "hi"`, `</ > “hi”`},
+		{`a</>b "c" 'd'`, `a</>b “c” ‘d’`},
+		{`</> <code>"raw"</code> "cooked"`, `</> <code>"raw"</code> “cooked”`},
+
+		// stray end tags for raw-text elements don’t leave us thinking we’re in some negative number of code elements
+		{`</code> "a" <code>"b"</code> "c"`, `</code> “a” <code>"b"</code> “c”`},
+		{`</code></code><code>'x'</code> 'y'`, `</code></code><code>'x'</code> ‘y’`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestAlerts(t *testing.T) {
+	rows := []Row{
+		{"> [!NOTE]\n> Don't say \"hi.\"", "> [!NOTE]\n> Don’t say “hi.”"},
+		{"> [!WARNING]\n>\n> It's 'fine'.", "> [!WARNING]\n>\n> It’s ‘fine’."},
+		{`> [!tip] "Quoted" title`, `> [!tip] “Quoted” title`},
+		{"> > [!faq-question]\n> > 'Nested'", "> > [!faq-question]\n> > ‘Nested’"},
+		{"[!NOTE] isn't an alert here", "[!NOTE] isn’t an alert here"},
+		{"> see [the 'docs'](url)", "> see [the ‘docs’](url)"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	opts := quotes.DefaultOptions()
+	opts.NumberRangeDashes = true
+	testRowsWithOptions(t, []Row{
+		{"> [!NOTE-1-2]\n> Pages 1-2", "> [!NOTE-1-2]\n> Pages 1–2"},
+	}, opts)
+}
+
+// TestConcurrentEducate is mostly for «go test -race»: Educate shouldn’t be touching anything that other calls to it can see.
+func TestConcurrentEducate(t *testing.T) {
+	in := "<p title=\"it's\" data-x='y'>She said, \"It's 'fine' -- 10-20.\"</p>\n\n<code>\"raw\"</code> `'code'` 1/2\n"
+	want, err := EducateString(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := EducateString(in)
+			if err != nil {
+				errs <- err
+			} else if got != want {
+				errs <- fmt.Errorf("expected «%s», got «%s»", want, got)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// BenchmarkAttributeHeavy is all about isLegalHTMLAttributeNameRune, which gets called once per rune of every attribute name.
+func BenchmarkAttributeHeavy(b *testing.B) {
+	in := strings.Repeat(`<a href="https://example.com/" title="It's here" data-long-attribute-name="x" aria-describedby="y">"link"</a> `, 200)
+	b.SetBytes(int64(len(in)))
+
+	for i := 0; i < b.N; i++ {
+		if _, err := EducateString(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSkipContexts(t *testing.T) {
+	in := "---\ntitle: 'x'\n---\n<p title=\"it's 'here'\">`'a'`</p>\n\n```\n'b'\n```\n\n<code>'c'</code>\n"
+
+	rows := map[quotes.Context]string{
+		quotes.ContextYAML:       "---\ntitle: ‘x’\n---\n<p title=\"it's 'here'\">`'a'`</p>\n\n```\n'b'\n```\n\n<code>'c'</code>\n",
+		quotes.ContextHTMLAttr:   "---\ntitle: 'x'\n---\n<p title=\"it’s ‘here’\">`'a'`</p>\n\n```\n'b'\n```\n\n<code>'c'</code>\n",
+		quotes.ContextInlineCode: "---\ntitle: 'x'\n---\n<p title=\"it's 'here'\">`‘a’`</p>\n\n```\n'b'\n```\n\n<code>'c'</code>\n",
+		quotes.ContextCodeBlock:  "---\ntitle: 'x'\n---\n<p title=\"it's 'here'\">`'a'`</p>\n\n```\n‘b’\n```\n\n<code>'c'</code>\n",
+		quotes.ContextScript:     "---\ntitle: 'x'\n---\n<p title=\"it's 'here'\">`'a'`</p>\n\n```\n'b'\n```\n\n<code>‘c’</code>\n",
+	}
+
+	// With everything skipped, there’s nothing to educate.
+	testRowsWithOptions(t, []Row{{in, in}}, quotes.DefaultOptions())
+
+	for context, want := range rows {
+		opts := quotes.DefaultOptions()
+		opts.SkipContexts = nil
+		for _, c := range quotes.DefaultOptions().SkipContexts {
+			if c != context {
+				opts.SkipContexts = append(opts.SkipContexts, c)
+			}
+		}
+
+		got, err := EducateStringWithOptions(in, opts)
+		if err != nil {
+			t.Errorf("%v: %v", context, err)
+		} else if got != want {
+			t.Errorf("\nwithout skipping %v\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", context, in, want, got)
+		}
+	}
+
+	opts := quotes.DefaultOptions()
+	opts.SkipContexts = nil
+	testRowsWithOptions(t, []Row{
+		{`<img alt='say "hi"' src="x.png">`, `<img alt='say “hi”' src="x.png">`},
+		{"```go\n'x'\n```", "```go\n‘x’\n```"},
+	}, opts)
+}
+
+func TestTaskLists(t *testing.T) {
+	rows := []Row{
+		{"- [ ] don't forget", "- [ ] don’t forget"},
+		{"- [x] it's done", "- [x] it’s done"},
+		{"* [X] \"Quoted\" task", "* [X] “Quoted” task"},
+		{"- [ ] 'single' task\n  - [x] nested 'one'", "- [ ] ‘single’ task\n  - [x] nested ‘one’"},
+		{"1. [ ] numbered 'task'", "1. [ ] numbered ‘task’"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	opts := quotes.DefaultOptions()
+	opts.NumberRangeDashes = true
+	testRowsWithOptions(t, []Row{
+		{"- [ ] read pages 10-20\n- [x] it's 2-3 pages", "- [ ] read pages 10–20\n- [x] it’s 2–3 pages"},
+	}, opts)
+}
+
+// TestHyphensInQuotes makes sure that --- is only ever front matter at the very start of a document, and never inside a quotation.
+func TestHyphensInQuotes(t *testing.T) {
+	rows := []Row{
+		{`"text --- more"`, `“text --- more”`},
+		{"\"text\n---\nmore\"", "“text\n---\nmore”"},
+		{"'text\n---\n' more 'x'", "‘text\n---\n’ more ‘x’"},
+		{"Intro\n---\n\"quoted\"\n---\n", "Intro\n---\n“quoted”\n---\n"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	// An attribute value being educated on its own isn’t the start of a document, either.
+	opts := quotes.DefaultOptions()
+	opts.SkipContexts = []quotes.Context{quotes.ContextYAML}
+	testRowsWithOptions(t, []Row{
+		{"<p title=\"---\n'hi'\n---\n\">'x'</p>", "<p title=\"---\n‘hi’\n---\n\">‘x’</p>"},
+	}, opts)
+}
+
+// TestMultiByteBeforeSentinel makes sure the unescaped-sentinel check looks at the whole rune before a closing backtick or quote, not just its last byte.
+func TestMultiByteBeforeSentinel(t *testing.T) {
+	rows := []Row{
+		{"`café` 'x'", "`café` ‘x’"},
+		{"`日本語` \"y\"", "`日本語` “y”"},
+		{"`🙂` 'z'", "`🙂` ‘z’"},
+		{"`naïve ‘€’` it's", "`naïve ‘€’` it’s"},
+		{`<p title="naïve" data-x='façade'>"ok"</p>`, `<p title="naïve" data-x='façade'>“ok”</p>`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestAutolinks(t *testing.T) {
+	rows := []Row{
+		{"<https://example.com/it's/'y'> 'a'", "<https://example.com/it's/'y'> ‘a’"},
+		{`<https://example.com/?q="a"&r='b'> "c"`, `<https://example.com/?q="a"&r='b'> “c”`},
+		{"<https://example.com/it's%3E> 'e'", "<https://example.com/it's%3E> ‘e’"},
+		{`<mailto:o'brien@example.com> "d"`, `<mailto:o'brien@example.com> “d”`},
+		{`<o'brien@example.com> "d"`, `<o'brien@example.com> “d”`},
+
+		// not really autolinks, but they shouldn’t trip anything up
+		{`<https://example.com/a>b'> "c"`, `<https://example.com/a>b’> “c”`},
+		{`<https://example.com/?q="a b"> "f"`, `<https://example.com/?q="a b"> “f”`},
+		{"<https://example.com/ 'h'\nand 'i'", "<https://example.com/ ‘h’\nand ‘i’"},
+		{`<svg:rect x="1"/> "g"`, `<svg:rect x="1"/> “g”`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestElidedYears(t *testing.T) {
+	rows := []Row{
+		{"class of '99", "class of ’99"},
+		{"the '80s and '00s", "the ’80s and ’00s"},
+		{"'90s kids", "’90s kids"},
+		{"'99 was 'fun'", "’99 was ‘fun’"},
+		{"the '10s, mostly", "the ’10s, mostly"},
+		{"He said, 'back in '85, it was fine.'", "He said, ‘back in ’85, it was fine.’"},
+		{`"the '20s"`, `“the ’20s”`},
+
+		// not years
+		{"'12' is a number", "‘12’ is a number"},
+		{"'123 Main St.'", "‘123 Main St.’"},
+		{"'99problems'", "‘99problems’"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestNoHTML(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.NoHTML = true
+
+	rows := []Row{
+		{`a <b "c"`, `a <b “c”`},
+		{`if a < b, "it's less"`, `if a < b, “it’s less”`},
+		{`<p title="x">'y'</p>`, `<p title=“x”>‘y’</p>`},
+		{`<code>"not code"</code>`, `<code>“not code”</code>`},
+		{"`<code>` \"still a code span\"", "`<code>` “still a code span”"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
+
+func TestCodeSpansInSingleQuotes(t *testing.T) {
+	rows := []Row{
+		{"'the command `ls -l` is handy'", "‘the command `ls -l` is handy’"},
+		{"'it's `x'y` ok' and 'z'", "‘it’s `x'y` ok’ and ‘z’"},
+		{"'`code`' then 'more'", "‘`code`’ then ‘more’"},
+		{"\"'`a`' b\"", "“‘`a`’ b”"},
+		{"'run `echo \"hi\"`', she said", "‘run `echo \"hi\"`’, she said"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestDashes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Dashes = true
+
+	rows := []Row{
+		{"a -- b", "a – b"},
+		{"1914--1918", "1914–1918"},
+		{"this--that", "this–that"},
+		{`"It's -- well -- 'fine'"`, `“It’s – well – ‘fine’”`},
+
+		// flags and other code-ish things
+		{"run it with --verbose", "run it with --verbose"},
+		{"--verbose at the start", "--verbose at the start"},
+		{"-- at the start", "-- at the start"},
+		{"ls --color=auto 'file'", "ls --color=auto ‘file’"},
+		{"an arrow --> there", "an arrow --> there"},
+		{"<!-- comment -->", "<!-- comment -->"},
+		{"hanging --", "hanging --"},
+		{"https://example.com/a--b", "https://example.com/a--b"},
+		{"`a -- b` and ```\nc -- d\n```", "`a -- b` and ```\nc -- d\n```"},
+
+		// task list markers stay hyphens
+		{"- [ ] this -- that", "- [ ] this – that"},
+
+		// three hyphens make an em dash
+		{"one---two", "one—two"},
+		{"one --- two", "one — two"},
+		{`"Wait---what?"`, `“Wait—what?”`},
+		{"a----b", "a----b"},
+		{"a -----b", "a -----b"},
+		{"---verbose", "---verbose"},
+		{"Let's take a breather.\n\n---\n\nWasn't that nice?.", "Let’s take a breather.\n\n---\n\nWasn’t that nice?."},
+		{"Title\n---\nBody---text", "Title\n---\nBody—text"},
+		{"---\ntitle: a---b\n---\nc---d", "---\ntitle: a---b\n---\nc—d"},
+		{"`a---b` a---b", "`a---b` a—b"},
+
+		// table delimiter rows aren’t dashes, but the cells around them can have some
+		{"| a --- b | c |\n| --- | -- |\n| d -- e | f |", "| a — b | c |\n| --- | -- |\n| d – e | f |"},
+		{"|---|:---:|", "|---|:---:|"},
+
+		// number ranges are what -- is for most of all
+		{"pages 10--20", "pages 10–20"},
+		{"(1914--1918)", "(1914–1918)"},
+		{"10---20 and 10----20", "10—20 and 10----20"},
+
+		// at the start of a line, it could be a list marker
+		{"Intro\n-- first\n-- second", "Intro\n-- first\n-- second"},
+		{"  -- indented", "  -- indented"},
+		{"before -- after\n-- start", "before – after\n-- start"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// off by default
+	testRowsWithOptions(t, []Row{{"a -- b", "a -- b"}}, quotes.DefaultOptions())
+}
+
+func TestInitialQuoteState(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.InitialQuoteState = quotes.InsideDoubleQuotes
+	testRowsWithOptions(t, []Row{
+		{`and that was that." Then "more."`, `and that was that.” Then “more.”`},
+		{`it's 'nested' here," she said.`, `it’s ‘nested’ here,” she said.`},
+		{`never closed`, `never closed`},
+		{`<p title="x">done."</p>`, `<p title="x">done.”</p>`},
+	}, opts)
+
+	opts.InitialQuoteState = quotes.InsideSingleQuotes
+	testRowsWithOptions(t, []Row{
+		{`don't stop,' he said. 'Fine.'`, `don’t stop,’ he said. ‘Fine.’`},
+	}, opts)
+
+	// which is why it’s needed: otherwise, there’s no telling the first " is a closing one
+	testRowsWithOptions(t, []Row{
+		{`and that was that." Then`, `and that was that.“ Then`},
+	}, quotes.DefaultOptions())
+}
+
+// TestExistingDashes makes sure Dashes only ever looks at ASCII hyphens, so dashes that are already there are left alone and educating twice is the same as educating once.
+func TestExistingDashes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Dashes = true
+
+	rows := []Row{
+		{"word—word and word--word", "word—word and word–word"},
+		{"1914–1918 and 1939--1945", "1914–1918 and 1939–1945"},
+		{"this – that -- and — the other", "this – that – and — the other"},
+		{"a—--b", "a—--b"},
+		{"a--–b", "a--–b"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	for _, row := range rows {
+		testRowsWithOptions(t, []Row{{row.Want, row.Want}}, opts)
+	}
+}
+
+func TestMultipleBacktickCodeSpans(t *testing.T) {
+	rows := []Row{
+		{"use ```a``` here \"quote\"", "use ```a``` here “quote”"},
+		{"use ```it's `x` ok``` 'y'", "use ```it's `x` ok``` ‘y’"},
+		{"``a`b`` 'c'", "``a`b`` ‘c’"},
+		{"``it's``` not closed'`` 'd'", "``it's``` not closed'`` ‘d’"},
+		{"never ``closed 'e'", "never ``closed ‘e’"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestHTMLInCodeSpansInQuotes(t *testing.T) {
+	rows := []Row{
+		{"\"`<b>`\"", "“`<b>`”"},
+		{"\"`<b>` tags\" and 'more'", "“`<b>` tags” and ‘more’"},
+		{"'`<i>`' \"y\"", "‘`<i>`’ “y”"},
+		{"\"`<code>` isn't closed\" 'z'", "“`<code>` isn’t closed” ‘z’"},
+		{"\"`</b>`\" and `<p title=\"x\">`", "“`</b>`” and `<p title=\"x\">`"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestHeadingQuoteStyle(t *testing.T) {
+	in := "Intro.\nMore intro.\n\n# \"Headline\" isn't 'here'\n\nBody \"text\" isn't 'here'.\n\n  ## Sub \"head\"\n#hashtag \"no\"\n"
+
+	opts := quotes.DefaultOptions()
+	opts.HeadingQuoteStyle = quotes.HeadingQuotesStraight
+	testRowsWithOptions(t, []Row{
+		{in, "Intro.\nMore intro.\n\n# \"Headline\" isn't 'here'\n\nBody “text” isn’t ‘here’.\n\n  ## Sub \"head\"\n#hashtag “no”\n"},
+		{"\"Title\"\n\nIt's \"body\".", "\"Title\"\n\nIt’s “body”."},
+		{"---\ntitle: x\n---\n\"Not a title\"\nstill the first paragraph", "---\ntitle: x\n---\n“Not a title”\nstill the first paragraph"},
+		{"# \"Unclosed\n\n\"closed\"", "# \"Unclosed\n\n“closed”"},
+		{"\"Title\"\n=======\nIt's \"body\".", "\"Title\"\n=======\nIt’s “body”."},
+
+		// a one-line document is just a short body, not a title
+		{"It's \"body\".", "It’s “body”."},
+		{"It's \"body\".\n", "It’s “body”.\n"},
+		{"It's \"body\".\n\n", "It’s “body”.\n\n"},
+	}, opts)
+
+	opts.HeadingQuoteStyle = quotes.HeadingQuotesSingle
+	testRowsWithOptions(t, []Row{
+		{in, "Intro.\nMore intro.\n\n# ‘Headline’ isn’t “here”\n\nBody “text” isn’t ‘here’.\n\n  ## Sub ‘head’\n#hashtag “no”\n"},
+		{"\"Title\"\n\nIt's \"body\".", "‘Title’\n\nIt’s “body”."},
+	}, opts)
+
+	// headings aren’t special by default
+	testRowsWithOptions(t, []Row{
+		{"# \"Headline\"", "# “Headline”"},
+	}, quotes.DefaultOptions())
+}
+
+func TestRawTextElementNamesMatchExactly(t *testing.T) {
+	rows := []Row{
+		{`<codex>"curled"</codex> 'too'`, `<codex>“curled”</codex> ‘too’`},
+		{`<code>"raw</codex> still raw"</code> "curled"`, `<code>"raw</codex> still raw"</code> “curled”`},
+		{`</codex> "a" <code>"b"</code> "c"`, `</codex> “a” <code>"b"</code> “c”`},
+		{`<kbdx>'x'</kbdx><kbd>'y'</kbd>`, `<kbdx>‘x’</kbdx><kbd>'y'</kbd>`},
+		{`<code class="x">"a"</code >"b"`, `<code class="x">"a"</code >“b”`},
+
+		// what comes right after the end tag is prose again
+		{`<code>x</code>, 'fine'`, `<code>x</code>, ‘fine’`},
+		{`<code>ééééé</code> "x" y "z"`, `<code>ééééé</code> “x” y “z”`},
+		{`<code>“curly” 'straight'</code>"after"`, `<code>“curly” 'straight'</code>“after”`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestPluralPossessives(t *testing.T) {
+	rows := []Row{
+		{"James' book", "James’ book"},
+		{"James's book", "James’s book"},
+		{"'James' book is here,' she said.", "‘James’ book is here,’ she said."},
+		{"'The Joneses' house,' he said, 'is big.'", "‘The Joneses’ house,’ he said, ‘is big.’"},
+		{"'It's the Smiths' car.'", "‘It’s the Smiths’ car.’"},
+		{`"'James' book,' she said"`, `“‘James’ book,’ she said”`},
+
+		// …but sometimes an s' is the end of the quotation after all
+		{"'I like cats' said Bob.", "‘I like cats’ said Bob."},
+		{"'I like cats' he said, 'and dogs.'", "‘I like cats’ he said, ‘and dogs.’"},
+		{"'Yes' and 'no'", "‘Yes’ and ‘no’"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestApostrophesAndSingleQuotesInDoubleQuotes(t *testing.T) {
+	rows := []Row{
+		{`"it's a 'small' world"`, "“it’s a ‘small’ world”"},
+		{`"don't worry," she said`, "“don’t worry,” she said"},
+		{`"I'm 'fine,' and it's 'true.'" He's sure.`, "“I’m ‘fine,’ and it’s ‘true.’” He’s sure."},
+		{`"it's 'the Joneses' house' now"`, "“it’s ‘the Joneses’ house’ now”"},
+		{`"'Small' isn't it," and 'after'`, "“‘Small’ isn’t it,” and ‘after’"},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+}
+
+func TestEllipses(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Ellipses = true
+
+	rows := []Row{
+		{"Wait...", "Wait…"},
+		{`"Well... maybe," she said.`, "“Well… maybe,” she said."},
+		{"'...and then'", "‘…and then’"},
+		{"end....", "end...."},
+		{"a. b. c.", "a. b. c."},
+		{"a.. b", "a.. b"},
+		{"Go ... on", "Go … on"},
+
+		// not in code, URLs, or paths
+		{"`a...b` and <code>c...</code> but d...", "`a...b` and <code>c...</code> but d…"},
+		{"```\nwait...\n```\nwait...", "```\nwait...\n```\nwait…"},
+		{"https://example.com/a...b is it...", "https://example.com/a...b is it…"},
+		{"<p title=\"more...\">more...</p>", "<p title=\"more...\">more…</p>"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// off by default
+	testRowsWithOptions(t, []Row{{"Wait...", "Wait..."}}, quotes.DefaultOptions())
+}
+
+func TestLog(t *testing.T) {
+	var entries []quotes.LogEntry
+	opts := quotes.DefaultOptions()
+	opts.Log = func(entry quotes.LogEntry) { entries = append(entries, entry) }
+
+	// The second one’s in an attribute value that gets educated separately, so its position has to be worked out from where the value starts.
+	opts.SkipContexts = []quotes.Context{quotes.ContextInlineCode}
+	if _, err := EducateStringWithOptions("(a)' and\n<p title=\"é (b)'\">", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log entries, got %d: %v", len(entries), entries)
+	}
+	for i, want := range [][3]int{{1, 4, 3}, {2, 16, 25}} {
+		entry := entries[i]
+		if entry.Kind != quotes.LogAmbiguousQuote || [3]int{entry.Line, entry.Column, entry.Offset} != want {
+			t.Errorf("entry %d: expected an %s at line %d, column %d, offset %d; got %+v", i, quotes.LogAmbiguousQuote, want[0], want[1], want[2], entry)
+		}
+	}
+}
+
+func TestLogPostcondition(t *testing.T) {
+	var entries []quotes.LogEntry
+	opts := quotes.DefaultOptions()
+	opts.Log = func(entry quotes.LogEntry) { entries = append(entries, entry) }
+
+	// A " can’t start an attribute value without an = before it.
+	if _, err := EducateStringWithOptions(`<a b"c">x</a>`, opts); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(entries) != 1 || entries[0].Kind != quotes.LogPostcondition || entries[0].Offset != 4 {
+		t.Fatalf("expected one %s entry at offset 4, got %v", quotes.LogPostcondition, entries)
+	}
+}
+
+func TestStripMarkdownEscapes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.StripMarkdownEscapes = true
+
+	rows := []Row{
+		{`\"Hi\"`, `"Hi"`},
+		{`It\'s`, `It's`},
+		{`\*not emphasis\*`, `*not emphasis*`},
+		{`"a \" b" and 'c'`, `“a " b” and ‘c’`},
+		{`\\ and \_`, `\ and _`},
+
+		// only ASCII punctuation can be escaped
+		{`C:\Users\me "x"`, `C:\Users\me “x”`},
+		{`\“curly”`, `\“curly”`},
+
+		// not in code
+		{"`\\\"` \"done\"", "`\\\"` “done”"},
+		{"```\n\\'\n```", "```\n\\'\n```"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// off by default
+	testRowsWithOptions(t, []Row{{`\"Hi\"`, `\"Hi\"`}}, quotes.DefaultOptions())
+}
+
+func TestCodeLikeWords(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.CodeLikeWords = true
+
+	rows := []Row{
+		{"it's_a_var", "it's_a_var"},
+		{"it's a var", "it’s a var"},
+		{"Call don't() first.", "Call don't() first."},
+		{"Set it's.value to 3.", "Set it's.value to 3."},
+		{"We don't.", "We don’t."},
+		{"(Don't.) That's all.", "(Don’t.) That’s all."},
+		{"Ask the U.S. gov't.", "Ask the U.S. gov’t."},
+		{"'Use it's_a_var,' she said.", "‘Use it's_a_var,’ she said."},
+		{"\"Don't call isn't_ok(),\" he said.", "“Don’t call isn't_ok(),” he said."},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// It’s opt-in.
+	testRowsWithOptions(t, []Row{{"it's_a_var", "it’s_a_var"}}, quotes.DefaultOptions())
+}
+
+func TestFlattenNesting(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.FlattenNesting = true
+
+	rows := []Row{
+		{`"He said 'hi' to me."`, `“He said “hi” to me.”`},
+		{"'Single' quotes", "“Single” quotes"},
+		{"‘Curly single’ quotes", "“Curly single” quotes"},
+		{`"I don't know 'em," she said.`, `“I don’t know ’em,” she said.`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}
+
+func TestEducateLine(t *testing.T) {
+	rows := []Row{
+		{`It's "here".` + "\n", "It’s “here”.\n"},
+
+		// a line after «```» or «"Unclosed» starts fresh
+		{"```\n", "```\n"},
+		{`'not code'`, "‘not code’"},
+		{`"Unclosed` + "\n", "“Unclosed\n"},
+		{`'closed'`, "‘closed’"},
+	}
+
+	for _, row := range rows {
+		got, err := quotes.EducateLine(row.In, quotes.DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != row.Want {
+			t.Errorf("\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", row.In, row.Want, got)
+		}
+	}
+}
+
+func TestCountChanges(t *testing.T) {
+	rows := []string{
+		"",
+		"No quotes here.",
+		"It's \"here\".",
+		"“Already” educated, isn’t it?",
+		"`don't` count code, but don't forget the rest",
+		"<p title=\"it's\">'Tis the season, rock 'n' roll.</p>",
+		"x‘s curly but wrong",
+		"---\ntitle: \"It's\"\n---\n\"Hi\"",
+		"'One,'\n> [!NOTE]\n> 'two'\n\n```\n'code'\n```\n<p\nclass=x>'three' <a>Twain</a>'s\n\"four\"",
+		"x</b> a >'hi'",
+		"</b>\n>'hi'",
+		"\" =</code>a</svg>&amp;}}\n>'",
+		"<p>1 >'s",
+		"<p>x\n>'y' z",
+	}
+
+	for _, row := range rows {
+		t.Run(row, func(t *testing.T) {
+			educated, err := EducateString(row)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// With DefaultOptions, educating swaps runes one for one, so the runes that changed are easy to count
+			want := 0
+			in, out := []rune(row), []rune(educated)
+			for i := range in {
+				if in[i] != out[i] {
+					want++
+				}
+			}
+
+			got, err := quotes.CountChanges(row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("expected %d changes, got %d (educated: «%s»)", want, got, educated)
+			}
+		})
+	}
+
+	// Educate drops a byte-order mark, and EducateWithEdits says so, so that’s a change, too
+	for _, row := range []struct {
+		in   string
+		want int
+	}{
+		{"\uFEFFhello", 1},
+		{"\uFEFFIt's", 2},
+	} {
+		got, err := quotes.CountChanges(row.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, edits, err := quotes.EducateWithEdits(row.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != row.want || len(edits) != row.want {
+			t.Errorf("«%s»: expected %d changes and edits, got %d changes and %d edits", row.in, row.want, got, len(edits))
+		}
+	}
+
+	if _, err := quotes.CountChanges("It's <code>never closed"); err == nil {
+		t.Error("expected an error for a <code> element that’s never closed")
+	}
+}
+
+func TestLegacyGraveQuotes(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.LegacyGraveQuotes = true
+
+	rows := []Row{
+		{"`legacy quote'", "‘legacy quote’"},
+		{"He said `don't' and left.", "He said ‘don’t’ and left."},
+		{"\"It's `nested' here\"", "“It’s ‘nested’ here”"},
+		{"```\n`code'\n```\n`prose'", "```\n`code'\n```\n‘prose’"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default, where backticks make code spans
+	testRowsWithOptions(t, []Row{{"`legacy quote'", "`legacy quote’"}}, quotes.DefaultOptions())
+}
+
+func TestResolveSingleQuote(t *testing.T) {
+	opts := quotes.DefaultOptions()
+
+	// Decades like '90s drop their century, so the quote before them is an apostrophe
+	opts.ResolveSingleQuote = func(ctx quotes.QuoteContext) quotes.QuoteKind {
+		if ctx.Next >= '0' && ctx.Next <= '9' {
+			return quotes.QuoteApostrophe
+		}
+		return quotes.DefaultResolveSingleQuote(ctx)
+	}
+
+	rows := []Row{
+		{"the '90s", "the ’90s"},
+		{"'Back in the '80s,' he said.", "‘Back in the ’80s,’ he said."},
+		{"'don't'", "‘don’t’"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	var seen []quotes.QuoteContext
+	opts.ResolveSingleQuote = func(ctx quotes.QuoteContext) quotes.QuoteKind {
+		seen = append(seen, ctx)
+		return quotes.DefaultResolveSingleQuote(ctx)
+	}
+	if _, err := EducateStringWithOptions(`"'Hi'"`, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []quotes.QuoteContext{
+		{Quote: '\'', Previous: '“', Next: 'H', InDoubleQuotes: true},
+		{Quote: '\'', Previous: 'i', Next: '"', InSingleQuotes: true, InDoubleQuotes: true},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("\nexpected: %+v\ngot:      %+v", want, seen)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	in := "(see above)'s"
+
+	if _, err := EducateString(in); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() == 0 {
+		t.Fatalf("expected «%s» to log something without Quiet", in)
+	}
+
+	logged.Reset()
+
+	opts := quotes.DefaultOptions()
+	opts.Quiet = true
+	testRowsWithOptions(t, []Row{{in, in}}, opts)
+
+	if logged.Len() != 0 {
+		t.Errorf("expected no log output with Quiet, got «%s»", logged.String())
+	}
+}
+
+func TestSmartNesting(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.SmartNesting = true
+
+	rows := []Row{
+		{`"She said "hi" to me"`, `“She said ‘hi’ to me”`},
+		{`"She said "hi""`, `“She said ‘hi’”`},
+		{`"He said "she said "no" twice" yesterday"`, `“He said ‘she said “no” twice’ yesterday”`},
+		{`"It's ("parenthetical") fine"`, `“It’s (‘parenthetical’) fine”`},
+		{`"It's （"wide"） and —"dashed"— too"`, `“It’s （‘wide’） and —‘dashed’— too”`},
+		{`"Two" and "three"`, `“Two” and “three”`},
+		{`"a" "b"`, `“a” “b”`},
+		{`“She said “hi” to me”`, `“She said “hi” to me”`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Off by default, where the inner quotes close and reopen
+	testRowsWithOptions(t, []Row{{`"She said "hi" to me"`, `“She said ”hi“ to me”`}}, quotes.DefaultOptions())
+}
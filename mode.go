@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// modesByExtension are the file extensions that -stdin-filename knows how to pick a -mode for. HTML gets markdown mode, since that already handles HTML; anything not in here gets markdown, too.
+var modesByExtension = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".html":     "markdown",
+	".htm":      "markdown",
+	".tex":      "latex",
+	".ltx":      "latex",
+	".typ":      "typst",
+	".dj":       "djot",
+	".txt":      "text",
+}
+
+// modeForFilename returns the -mode that a file named name should be educated in, judging by its extension.
+func modeForFilename(name string) string {
+	if mode, ok := modesByExtension[strings.ToLower(filepath.Ext(name))]; ok {
+		return mode
+	}
+	return "markdown"
+}
+
+// applyMode sets whatever opts needs to read the input the way mode says to: markdown (nothing to set), latex, typst, djot, or text, which is like markdown with NoHTML.
+func applyMode(opts *Options, mode string) error {
+	switch mode {
+	case "", "markdown":
+	case "latex":
+		opts.LaTeX = true
+	case "typst":
+		opts.Typst = true
+	case "djot":
+		opts.Djot = true
+	case "text":
+		opts.NoHTML = true
+	default:
+		return fmt.Errorf("unknown mode «%s»; expected markdown, latex, typst, djot, or text", mode)
+	}
+	return nil
+}
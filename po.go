@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// poString is one quoted string of a PO file, split up so the bits around the quoted part can be copied back exactly.
+type poString struct {
+	before  string // the keyword (or indentation) and the opening quote
+	content string // what’s between the quotes, still escaped
+	after   string // the closing quote and whatever’s after it, newline included
+}
+
+// EducatePO reads a gettext PO file from in, educates its msgstr strings, and writes the result to out.
+//
+// msgids, msgctxts, comments, and the header entry (the one with the empty msgid) are all copied as-is. A msgstr that’s split across several lines is educated as one string, so a quote opened on one line closes on the next.
+func EducatePO(in io.Reader, out io.Writer) error {
+	return EducatePOWithOptions(in, out, DefaultOptions())
+}
+
+// EducatePOWithOptions is like EducatePO, but educates msgstrs with whatever quote marks opts has, so German translations can get German quotes.
+func EducatePOWithOptions(in io.Reader, out io.Writer, opts Options) error {
+	contents, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	var msgid, msgstr []poString
+	var keyword string
+
+	flush := func() error {
+		if msgstr == nil {
+			return nil
+		}
+		if !isPOHeader(msgid) {
+			if err := educatePOStrings(msgstr, opts); err != nil {
+				return err
+			}
+		}
+		for _, ps := range msgstr {
+			b.WriteString(ps.before + ps.content + ps.after)
+		}
+		msgstr = nil
+		return nil
+	}
+
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if !strings.HasPrefix(trimmed, `"`) {
+			// Anything that isn’t a continuation line ends the msgstr we were collecting.
+			if err := flush(); err != nil {
+				return err
+			}
+			keyword, _, _ = strings.Cut(trimmed, " ")
+			if keyword == "msgid" {
+				msgid = nil
+			}
+		}
+
+		ps, ok := parsePOString(line)
+		switch {
+		case ok && strings.HasPrefix(keyword, "msgstr"):
+			// msgstr[0] and msgstr[1] are separate strings, so each one gets educated on its own. The flush above took care of the one before.
+			msgstr = append(msgstr, ps)
+			continue
+		case ok && keyword == "msgid":
+			msgid = append(msgid, ps)
+		}
+
+		b.WriteString(line)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, b.String())
+	return err
+}
+
+// parsePOString splits a line like `msgstr "It's"` or `"more"` into its parts. It returns false if there’s no quoted string on the line.
+func parsePOString(line string) (poString, bool) {
+	start := strings.IndexByte(line, '"')
+	end := strings.LastIndexByte(strings.TrimRight(line, " \t\r\n"), '"')
+	if start < 0 || end <= start {
+		return poString{}, false
+	}
+
+	return poString{
+		before:  line[:start+1],
+		content: line[start+1 : end],
+		after:   line[end:],
+	}, true
+}
+
+// isPOHeader reports whether a msgid is the empty one that marks the header entry, whose msgstr is metadata and not a translation.
+func isPOHeader(msgid []poString) bool {
+	for _, ps := range msgid {
+		if ps.content != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// educatePOStrings educates the contents of strs as if they were one string and puts the results back in strs.
+//
+// Educating doesn’t usually change how many runes there are — it swaps straight quotes for curly ones one for one — so that’s how I split the result back up. If some option (like Fractions) changes the count, I give up on carrying quotes across lines and educate each line separately.
+func educatePOStrings(strs []poString, opts Options) error {
+	var joined strings.Builder
+	for _, ps := range strs {
+		joined.WriteString(unescapePOQuotes(ps.content))
+	}
+
+	educated, err := educateString(joined.String(), opts)
+	if err != nil {
+		return err
+	}
+
+	if utf8.RuneCountInString(educated) != utf8.RuneCountInString(joined.String()) {
+		for i := range strs {
+			educated, err := educateString(unescapePOQuotes(strs[i].content), opts)
+			if err != nil {
+				return err
+			}
+			strs[i].content = escapePOQuotes(educated)
+		}
+		return nil
+	}
+
+	for i := range strs {
+		n := utf8.RuneCountInString(unescapePOQuotes(strs[i].content))
+		cut := 0
+		for ; n > 0; n-- {
+			_, size := utf8.DecodeRuneInString(educated[cut:])
+			cut += size
+		}
+		strs[i].content = escapePOQuotes(educated[:cut])
+		educated = educated[cut:]
+	}
+
+	return nil
+}
+
+// unescapePOQuotes turns \" back into ". Every other escape (\n, \t, \\) is left as it is — the educator copies backslash escapes through untouched, and that’s exactly what I want for those.
+func unescapePOQuotes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			if s[i+1] != '"' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escapePOQuotes undoes unescapePOQuotes. Any straight double quote still left after educating needs its backslash back.
+func escapePOQuotes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			b.WriteString(s[i : i+2])
+			i++
+			continue
+		}
+		if s[i] == '"' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
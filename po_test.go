@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"strings"
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducatePO(t *testing.T) {
+	const header = "msgid \"\"\nmsgstr \"\"\n\"Language: fr\\n\"\n\"X-Note: don't \\\"touch\\\" this\\n\"\n\n"
+
+	rows := []Row{
+		{
+			header + "#: main.go:12\n# It's a comment.\nmsgid \"Don't \\\"panic\\\"\"\nmsgstr \"Don't \\\"panic\\\"\"\n",
+			header + "#: main.go:12\n# It's a comment.\nmsgid \"Don't \\\"panic\\\"\"\nmsgstr \"Don’t “panic”\"\n",
+		},
+		{
+			"msgctxt \"it's\"\nmsgid \"I can't\"\nmsgstr \"\"\n\"I can't say \\\"hello \"\n\"world\\\" and that's that.\\n\"\n",
+			"msgctxt \"it's\"\nmsgid \"I can't\"\nmsgstr \"\"\n\"I can’t say “hello \"\n\"world” and that’s that.\\n\"\n",
+		},
+		{
+			"msgid \"one file's\"\nmsgid_plural \"%d files'\"\nmsgstr[0] \"'one' file's\"\nmsgstr[1] \"'%d' files'\"\n",
+			"msgid \"one file's\"\nmsgid_plural \"%d files'\"\nmsgstr[0] \"‘one’ file’s\"\nmsgstr[1] \"‘%d’ files’\"\n",
+		},
+		{
+			"#~ msgid \"it's\"\n#~ msgstr \"it's\"\n",
+			"#~ msgid \"it's\"\n#~ msgstr \"it's\"\n",
+		},
+		{
+			"msgid \"backslash\"\nmsgstr \"a \\\\ \\\"backslash\\\"\"\r\n",
+			"msgid \"backslash\"\nmsgstr \"a \\\\ “backslash”\"\r\n",
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.In, func(t *testing.T) {
+			var out strings.Builder
+			if err := quotes.EducatePO(strings.NewReader(row.In), &out); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != row.Want {
+				t.Errorf("\ngot  %q\nwant %q", got, row.Want)
+			}
+		})
+	}
+}
+
+func TestEducatePOWithOptions(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.OpenDouble, opts.CloseDouble = '„', '“'
+
+	in := "msgid \"Say \\\"cheese\\\"\"\nmsgstr \"Sag \\\"Käse\\\"\"\n"
+	want := "msgid \"Say \\\"cheese\\\"\"\nmsgstr \"Sag „Käse“\"\n"
+
+	var out strings.Builder
+	if err := quotes.EducatePOWithOptions(strings.NewReader(in), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want {
+		t.Errorf("\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// straightener turns curly quotes, primes, and apostrophes back into straight ones.
+var straightener = strings.NewReplacer(
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+)
+
+// Straighten undoes Educate’s quote curling, turning every curly quote, apostrophe, and prime in s into a straight ' or ".
+//
+// It doesn’t care about context, so any curly quotes that were in code to begin with get straightened, too. Guillemets and other languages’ quote marks are left alone, since there’s no telling whether they came from Educate.
+func Straighten(s string) string {
+	return straightener.Replace(s)
+}
+
+// StraightenApostrophes turns only the apostrophes in s back into straight ones, leaving real quotation marks curly.
+//
+// This is for spell checkers, most of which choke on “don’t” but are fine with “don't”. Run the educated text through this and feed the result to the spell checker while keeping the curly version for publishing. Since an apostrophe and a closing single quote are the same character, I only straighten a ’ that has a letter or digit right after it (“don’t”, “’tis”, “the ’90s”) and leave any other ones alone, so a plural possessive like “the Joneses’ house” stays curly. That’s rarely a problem for spell checkers, since the word before it is spelled right either way.
+func StraightenApostrophes(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i, r := range s {
+		if r == '’' {
+			if next, _ := utf8.DecodeRuneInString(s[i+len("’"):]); unicode.IsLetter(next) || unicode.IsDigit(next) {
+				b.WriteByte('\'')
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestStraighten(t *testing.T) {
+	rows := []Row{
+		{"“It’s ‘here’,” she said.", `"It's 'here'," she said.`},
+		{"„Deutsch“ und ‚so‘", `"Deutsch" und 'so'`},
+		{"5′ 10″", `5' 10"`},
+		{"«Bonjour»", "«Bonjour»"},
+		{"no quotes", "no quotes"},
+	}
+
+	for _, row := range rows {
+		if got := quotes.Straighten(row.In); got != row.Want {
+			t.Errorf("\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", row.In, row.Want, got)
+		}
+	}
+
+	// Straightening undoes educating
+	for _, in := range []string{`It's "here".`, `"I'm 'nested'," he said.`} {
+		educated, err := EducateString(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := quotes.Straighten(educated); got != in {
+			t.Errorf("expected «%s» to straighten back to «%s», got «%s»", educated, in, got)
+		}
+	}
+}
+
+func TestStraightenApostrophes(t *testing.T) {
+	rows := []Row{
+		{"“It’s ‘here’,” she said.", "“It's ‘here’,” she said."},
+		{"Don’t ’em", "Don't 'em"},
+		{"the ’90s", "the '90s"},
+		{"‘Nested’ quotes stay", "‘Nested’ quotes stay"},
+		{"the Joneses’ house", "the Joneses’ house"},
+		{"5′ 10″", "5′ 10″"},
+		{"’", "’"},
+	}
+
+	for _, row := range rows {
+		if got := quotes.StraightenApostrophes(row.In); got != row.Want {
+			t.Errorf("\nsource:   «%s»\nexpected: «%s»\ngot:      «%s»", row.In, row.Want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EducateSubtitles reads an SRT or WebVTT file from in, educates the text of each cue, and writes the result to out.
+//
+// Cue numbers, cue identifiers, and timing lines (whose --> stays as it is) are copied as-is, as are blocks without a timing line, like WebVTT’s header and its NOTE, STYLE, and REGION blocks. Each cue is educated on its own, so a quote left open in one cue doesn’t spill into the next.
+//
+// format is either "srt" or "vtt", in any case.
+func EducateSubtitles(in io.Reader, out io.Writer, format string) error {
+	format = strings.ToLower(format)
+	if format != "srt" && format != "vtt" {
+		return fmt.Errorf("EducateSubtitles: unknown subtitle format «%s»; expected srt or vtt", format)
+	}
+
+	contents, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if format == "vtt" && !strings.HasPrefix(strings.TrimPrefix(string(contents), "\uFEFF"), "WEBVTT") {
+		return fmt.Errorf("EducateSubtitles: WebVTT files have to start with WEBVTT")
+	}
+
+	var b strings.Builder
+	var block []string
+
+	flush := func() error {
+		educated, err := educateSubtitleBlock(block)
+		if err != nil {
+			return err
+		}
+		b.WriteString(educated)
+		block = block[:0]
+		return nil
+	}
+
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return err
+			}
+			b.WriteString(line)
+			continue
+		}
+		block = append(block, line)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, b.String())
+	return err
+}
+
+// educateSubtitleBlock educates the lines after a block’s timing line and copies everything else. Blocks that don’t have a timing line aren’t cues, so they’re copied as-is.
+func educateSubtitleBlock(lines []string) (string, error) {
+	for i, line := range lines {
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+
+		text, err := educateString(strings.Join(lines[i+1:], ""), DefaultOptions())
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(lines[:i+1], "") + text, nil
+	}
+
+	return strings.Join(lines, ""), nil
+}
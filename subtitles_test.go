@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"strings"
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestEducateSubtitles(t *testing.T) {
+	rows := []struct {
+		Name   string
+		Format string
+		In     string
+		Want   string
+	}{
+		{
+			"srt",
+			"srt",
+			"1\n00:00:01,000 --> 00:00:04,000\nI don't know what \"it\" is.\n\n2\n00:00:05,000 --> 00:00:07,500\n- It's <i>right there</i>.\n- 'Where?'\n",
+			"1\n00:00:01,000 --> 00:00:04,000\nI don’t know what “it” is.\n\n2\n00:00:05,000 --> 00:00:07,500\n- It’s <i>right there</i>.\n- ‘Where?’\n",
+		},
+		{
+			"srt with crlf",
+			"SRT",
+			"1\r\n00:00:01,000 --> 00:00:04,000\r\nThat's \"that.\"\r\n\r\n",
+			"1\r\n00:00:01,000 --> 00:00:04,000\r\nThat’s “that.”\r\n\r\n",
+		},
+		{
+			"vtt",
+			"vtt",
+			"WEBVTT - It's a test\n\nNOTE Don't educate \"this\"\n\nintro\n00:00:01.000 --> 00:00:04.000 align:start\nWe're <c.yellow>\"live\"</c>.\n",
+			"WEBVTT - It's a test\n\nNOTE Don't educate \"this\"\n\nintro\n00:00:01.000 --> 00:00:04.000 align:start\nWe’re <c.yellow>“live”</c>.\n",
+		},
+		{
+			"quotes don't spill across cues",
+			"srt",
+			"1\n00:00:01,000 --> 00:00:02,000\n\"Unclosed\n\n2\n00:00:03,000 --> 00:00:04,000\n\"Opened\" again\n",
+			"1\n00:00:01,000 --> 00:00:02,000\n“Unclosed\n\n2\n00:00:03,000 --> 00:00:04,000\n“Opened” again\n",
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.Name, func(t *testing.T) {
+			var out strings.Builder
+			if err := quotes.EducateSubtitles(strings.NewReader(row.In), &out, row.Format); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != row.Want {
+				t.Errorf("\nexpected: «%s»\ngot:      «%s»", row.Want, out.String())
+			}
+		})
+	}
+}
+
+func TestEducateSubtitlesBadInput(t *testing.T) {
+	var out strings.Builder
+	if err := quotes.EducateSubtitles(strings.NewReader("1\n"), &out, "ass"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if err := quotes.EducateSubtitles(strings.NewReader("1\n"), &out, "vtt"); err == nil {
+		t.Error("expected an error for a WebVTT file without a header")
+	}
+}
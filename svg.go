@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// inSVGElement copies an inline <svg> element through its </svg> end tag without curling anything, except for the insides of <text> elements when SVGText is set. It’s called with the start tag’s > up next.
+//
+// Its start and end tags are like HTML’s, self-closing <rect/>s and all, but everything in between is markup, not prose. An <svg> that’s never closed is an error, unless Lenient is set, in which case it’s just a start tag.
+func inSVGElement(s *state) error {
+	end := indexTagFold(s.src[s.currentOffset():], "</svg")
+	if end < 0 {
+		if s.opts.Lenient {
+			return s.writeRune(s.mustReadRune())
+		}
+		line := bytes.Count(s.src[:s.currentOffset()], []byte("\n")) + 1
+		return fmt.Errorf("the <svg> start tag on line %d is never closed with a </svg> end tag", line)
+	}
+
+	for s.opts.SVGText {
+		ahead := s.src[s.currentOffset():]
+		end = indexTagFold(ahead, "</svg")
+
+		text := indexTagFold(ahead[:end], "<text")
+		if text < 0 {
+			break
+		}
+
+		// Everything up to the <text> and its start tag is markup…
+		if err := s.AdvanceBy(utf8.RuneCount(ahead[:text])); err != nil {
+			return err
+		}
+		if err := s.AdvanceThrough(">"); err != nil {
+			return err
+		}
+
+		// …and everything from there to its end tag is prose.
+		ahead = s.src[s.currentOffset():]
+		end = indexTagFold(ahead, "</svg")
+		closing := indexTagFold(ahead[:end], "</text")
+		if closing < 0 {
+			closing = end
+		}
+		if err := s.educateSpan(closing, s.opts); err != nil {
+			return err
+		}
+	}
+
+	if err := s.AdvanceBy(utf8.RuneCount(s.src[s.currentOffset() : s.currentOffset()+int64(end)])); err != nil {
+		return err
+	}
+	return s.AdvanceThrough(">")
+}
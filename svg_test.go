@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+const inlineSVG = `<svg viewBox="0 0 10 10">
+  <path d="M0,0 L10,10" style='stroke: "red"'/>
+  <rect x="1" y='2'/>
+  <text font-family='Georgia' x="0">It's "here" <tspan font-style="italic">'now'</tspan></text>
+  <desc>"not" prose</desc>
+</svg>
+It's "after".`
+
+func TestSVG(t *testing.T) {
+	rows := []Row{
+		{inlineSVG, `<svg viewBox="0 0 10 10">
+  <path d="M0,0 L10,10" style='stroke: "red"'/>
+  <rect x="1" y='2'/>
+  <text font-family='Georgia' x="0">It's "here" <tspan font-style="italic">'now'</tspan></text>
+  <desc>"not" prose</desc>
+</svg>
+It’s “after”.`},
+		{`<SVG><text>'x'</text></SVG> 'y'`, `<SVG><text>'x'</text></SVG> ‘y’`},
+		{`<svg/> "self-closing"`, `<svg/> “self-closing”`},
+		{`<svgx>"not svg"</svgx>`, `<svgx>“not svg”</svgx>`},
+	}
+
+	testRowsWithOptions(t, rows, quotes.DefaultOptions())
+
+	opts := quotes.DefaultOptions()
+	opts.SVGText = true
+	testRowsWithOptions(t, []Row{
+		{inlineSVG, `<svg viewBox="0 0 10 10">
+  <path d="M0,0 L10,10" style='stroke: "red"'/>
+  <rect x="1" y='2'/>
+  <text font-family='Georgia' x="0">It’s “here” <tspan font-style="italic">‘now’</tspan></text>
+  <desc>"not" prose</desc>
+</svg>
+It’s “after”.`},
+		// each <text> is educated on its own, so a quote left open in one doesn’t spill into the next
+		{`<svg><text>"open</text><text>'two'</text></svg>`, `<svg><text>“open</text><text>‘two’</text></svg>`},
+		{`<svg><text><textPath href="#p">'on a path'</textPath></text></svg>`, `<svg><text><textPath href="#p">‘on a path’</textPath></text></svg>`},
+	}, opts)
+}
+
+func TestUnclosedSVG(t *testing.T) {
+	_, err := EducateString(`<svg><text>"x"</text>`)
+	if err == nil {
+		t.Fatal("expected an error for an <svg> element that’s never closed")
+	}
+	if want := "the <svg> start tag on line 1 is never closed with a </svg> end tag"; err.Error() != want {
+		t.Errorf("expected «%s», got «%s»", want, err)
+	}
+
+	opts := quotes.DefaultOptions()
+	opts.Lenient = true
+	testRowsWithOptions(t, []Row{
+		{`<svg>"x"`, `<svg>“x”`},
+	}, opts)
+}
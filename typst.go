@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// typstKeywords start lines of code that go on until the end of the line, like «#let name = "value"».
+var typstKeywords = map[string]bool{
+	"let": true, "set": true, "show": true, "import": true, "include": true,
+	"if": true, "else": true, "for": true, "while": true, "return": true,
+}
+
+// registerTypst swaps the Markdown-and-HTML-specific callbacks for Typst ones. Backslash escapes and backtick raw text work the same way in both, so those stay.
+func registerTypst(s *state) {
+	delete(s.whatDo, '<') // Typst doesn’t have HTML, and «<intro>» is a label
+
+	s.whatDo['/'] = atTypstSlash
+	s.whatDo['#'] = atTypstHash
+	s.whatDo['$'] = atTypstDollar
+}
+
+// atTypstSlash reads an assumed-to-exist /. If it starts a // or /* comment, the whole comment is copied as-is.
+//
+// The // in «https://» isn’t a comment, so a / right after a colon is just a slash.
+func atTypstSlash(s *state) error {
+	afterColon := s.previousRuneMatchesAny(':')
+
+	r := s.mustReadRune()
+	if r != '/' {
+		return fmt.Errorf("expecting a slash. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	switch {
+	case afterColon:
+		return nil
+	case s.PeekEquals("/"):
+		return s.AdvanceUntil("\n")
+	case s.PeekEquals("*"):
+		return s.AdvanceThrough("*/")
+	}
+
+	return nil
+}
+
+// atTypstHash reads an assumed-to-exist # and copies the code expression it starts.
+//
+// That’s the name after the #, and then any argument lists in parentheses and code blocks in braces, so «#link("https://example.com")» stays as it is. Content blocks in brackets are markup, so atTypstHash stops at those and lets them get educated like the rest of the document: the [It's] in «#emph[It's]» gets an apostrophe. Lines starting with a keyword, like «#let» and «#set», are all code, so they’re copied through to the end of the line.
+func atTypstHash(s *state) error {
+	r := s.mustReadRune()
+	if r != '#' {
+		return fmt.Errorf("expecting a #. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	start := s.w.Len()
+	if err := s.AdvanceUntilFalse(isTypstIdentifierRune); err != nil {
+		return err
+	}
+
+	if typstKeywords[string(s.w.Bytes()[start:])] {
+		return s.AdvanceUntil("\n")
+	}
+
+	for {
+		p, err := s.peekRune()
+		if err != nil {
+			return err
+		}
+
+		switch p {
+		case '(':
+			err = copyTypstCode(s, '(', ')')
+		case '{':
+			err = copyTypstCode(s, '{', '}')
+		case '.':
+			// a method call or a field, like «#str.len()», if there’s a name after the dot; otherwise it’s the end of a sentence
+			if next, err := s.peekRuneAt(1); err != nil || !unicode.IsLetter(next) {
+				return nil
+			}
+			s.writeRune(s.mustReadRune())
+			err = s.AdvanceUntilFalse(isTypstIdentifierRune)
+		default:
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// atTypstDollar reads an assumed-to-exist $ and copies the math it starts through the closing $. Quotes in math are strings, not prose.
+func atTypstDollar(s *state) error {
+	r := s.mustReadRune()
+	if r != '$' {
+		return fmt.Errorf("expecting a dollar sign. got: «%s» (%U)", string(r), r)
+	}
+	s.writeRune(r)
+
+	if !s.unescapedRuneAhead('$') {
+		return nil
+	}
+
+	return inSpanEndingWithSingleUnescapedRune(s, '$')
+}
+
+// copyTypstCode copies everything from an open rune through its matching close rune, skipping over any strings along the way so a ) in a string doesn’t count.
+func copyTypstCode(s *state, open, close rune) error {
+	depth := 0
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return err
+		}
+		s.writeRune(r)
+
+		switch r {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		case '"':
+			if err := inSpanEndingWithSingleUnescapedRune(s, '"'); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isTypstIdentifierRune returns true for runes that can be in a Typst identifier after the first one.
+func isTypstIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main_test
+
+import (
+	"testing"
+
+	quotes "github.com/adiabatic/quote-educator"
+)
+
+func TestTypst(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Typst = true
+
+	rows := []Row{
+		{"It's \"Typst\".", "It’s “Typst”."},
+		{"Use `print(\"hi\")` and it's done.", "Use `print(\"hi\")` and it’s done."},
+		{"```python\nprint('hi')\n```\nThat's it.", "```python\nprint('hi')\n```\nThat’s it."},
+		{"// don't \"touch\" this\nBut it's fine.", "// don't \"touch\" this\nBut it’s fine."},
+		{"/* it's\n\"here\" */ it's", "/* it's\n\"here\" */ it’s"},
+		{"See https://example.com/it's for \"more\".", "See https://example.com/it's for “more”."},
+		{`#let title = "It's mine"` + "\nIt's yours.", `#let title = "It's mine"` + "\nIt’s yours."},
+		{`#set text(font: "Linux Libertine", lang: "en")` + "\n\"Hi\"", `#set text(font: "Linux Libertine", lang: "en")` + "\n“Hi”"},
+		{`#link("https://example.com/(it's)")[It's "here"]`, `#link("https://example.com/(it's)")[It’s “here”]`},
+		{`#emph[Don't] and #strong("it's").`, `#emph[Don’t] and #strong("it's").`},
+		{`#calc.max(1, 2). "Done."`, `#calc.max(1, 2). “Done.”`},
+		{`$"area" = pi r^2$ is "math"`, `$"area" = pi r^2$ is “math”`},
+		{"---\n\"Dash\" <intro>", "---\n“Dash” <intro>"},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+
+	// Dashes work in Typst documents, too
+	opts.Dashes = true
+	opts.NumberRangeDashes = true
+	testRowsWithOptions(t, []Row{
+		{"It's -- \"here\" --- see pages 10-20.", "It’s – “here” — see pages 10–20."},
+		{"---\n\"Dash\"", "---\n“Dash”"},
+	}, opts)
+}
+
+func TestQuotedTypstMath(t *testing.T) {
+	opts := quotes.DefaultOptions()
+	opts.Typst = true
+
+	rows := []Row{
+		{`"the formula $x='y'$ is simple"`, `“the formula $x='y'$ is simple”`},
+		{`"the formula $x = "y"$ is simple"`, `“the formula $x = "y"$ is simple”`},
+	}
+
+	testRowsWithOptions(t, rows, opts)
+}